@@ -17,6 +17,9 @@ const Cyan = "\033[36m"
 const Purple = "\033[35m"
 const Reset = "\033[0m"
 
+// BinaryName is the name of the released binary, used in the hints telling what to run.
+const BinaryName = "pcfy-my-mac"
+
 var ExecCommand = exec.Command
 
 func Exists(command string) bool {
@@ -33,6 +36,21 @@ func Exists(command string) bool {
 	}
 }
 
+func IsRunning(process string) bool {
+	return ExecCommand("pgrep", "-x", process).Run() == nil
+}
+
+// ReadDefaults returns the value of a macOS user defaults key, if it is set.
+func ReadDefaults(domain, key string) (string, bool) {
+	output, err := ExecCommand("defaults", "read", domain, key).Output()
+
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(string(output)), true
+}
+
 func GetOrDefaultString(launcher string, launcher2 *string) string {
 	if launcher2 != nil {
 		return *launcher2
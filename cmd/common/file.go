@@ -10,11 +10,43 @@ import (
 	"strings"
 )
 
-func CopyFileFromEmbedFS(src, dst string) error {
-	assetsFs := &assets.Assets
-	data, _ := fs.ReadFile(assetsFs, src)
-	os.MkdirAll(filepath.Dir(dst), 0755)
-	return os.WriteFile(dst, data, 0755)
+// WriteFile writes to a temporary file next to dst first and then renames it, so a failure
+// never leaves a half-written file behind.
+func WriteFile(dst string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dst)
 }
 
 func ReadFileFromEmbedFS(src string) (string, error) {
@@ -23,6 +55,22 @@ func ReadFileFromEmbedFS(src string) (string, error) {
 	return string(data), nil
 }
 
+func ReadDirFromEmbedFS(dir string) ([]string, error) {
+	entries, err := fs.ReadDir(&assets.Assets, dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names, nil
+}
+
 func CopyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 
@@ -87,23 +135,6 @@ func FindMatchingPaths(pattern string, destFile string) ([]string, error) {
 	return matchingDirs, nil
 }
 
-func ReplaceWordInFile(path, oldWord, newWord string) error {
-
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return err
-	}
-
-	modifiedContent := strings.ReplaceAll(string(content), oldWord, newWord)
-
-	err = os.WriteFile(path, []byte(modifiedContent), 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func TextFromFile(paramsFile string) (string, error) {
 	d, e := os.ReadFile(paramsFile)
 
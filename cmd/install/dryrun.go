@@ -0,0 +1,126 @@
+package install
+
+import (
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DryRunCommander records what an installation would do instead of doing it.
+type DryRunCommander struct {
+	// Log receives every event as JSON, marked as dry run.
+	Log io.Writer
+	// Format is the console log format. In the JSON one the events are printed as they come instead of the plan.
+	Format string
+
+	entries []dryRunEntry
+	task    string
+}
+
+type dryRunEntry struct {
+	msg  LogMessage
+	text string
+}
+
+func NewDryRunCommander() *DryRunCommander {
+	return &DryRunCommander{}
+}
+
+func (c *DryRunCommander) Run(command string) (CommandResult, error) {
+	if command != "clear" {
+		c.TryLog(CmdMsg, command)
+	}
+
+	return CommandResult{}, nil
+}
+
+func (c *DryRunCommander) Exit(code int) {
+	os.Exit(code)
+}
+
+func (c *DryRunCommander) TryLog(logMsg LogMessage, output string) {
+
+	output = strings.ReplaceAll(output, os.Getenv("HOME"), "~")
+
+	if logMsg.msgType == TaskMsg.msgType {
+		c.task = output
+	}
+
+	event := LogEvent{
+		Timestamp: time.Now(),
+		Task:      c.task,
+		Type:      logMsg.msgType,
+		Text:      strings.TrimSuffix(output, "\n"),
+		DryRun:    true,
+	}
+
+	if c.Log != nil && len(output) != 0 {
+		writeEvent(c.Log, event)
+	}
+
+	if c.Format == JsonLogFormat {
+		if len(output) != 0 {
+			writeEvent(os.Stdout, event)
+		}
+	} else if logMsg.msgType == ErrMsg.msgType || logMsg.msgType == StdErrMsg.msgType {
+		log(logMsg, output)
+	} else if len(output) != 0 {
+		c.entries = append(c.entries, dryRunEntry{logMsg, output})
+	}
+}
+
+func (c *DryRunCommander) PrintPlan() {
+	if c.Format == JsonLogFormat {
+		return
+	}
+
+	fmt.Println("Dry run, nothing has been changed. The installation would do the following:")
+	fmt.Println()
+
+	for _, e := range c.entries {
+		log(e.msg, e.text)
+	}
+}
+
+// DryRunFileSystem keeps written files in memory, so later tasks still see the changes of
+// the earlier ones while nothing is written to disk.
+type DryRunFileSystem struct {
+	files   map[string][]byte
+	removed map[string]bool
+}
+
+func NewDryRunFileSystem() *DryRunFileSystem {
+	return &DryRunFileSystem{files: map[string][]byte{}, removed: map[string]bool{}}
+}
+
+func (fs *DryRunFileSystem) ReadFile(path string) ([]byte, error) {
+	if data, ok := fs.files[path]; ok {
+		return data, nil
+	}
+
+	if fs.removed[path] {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	return os.ReadFile(path)
+}
+
+func (fs *DryRunFileSystem) WriteFile(path string, data []byte) error {
+	fs.files[path] = data
+	delete(fs.removed, path)
+	return nil
+}
+
+func (fs *DryRunFileSystem) FileExists(path string) bool {
+	_, ok := fs.files[path]
+	return ok || (!fs.removed[path] && common.FileExists(path))
+}
+
+func (fs *DryRunFileSystem) RemoveFile(path string) error {
+	delete(fs.files, path)
+	fs.removed[path] = true
+	return nil
+}
@@ -0,0 +1,143 @@
+package install
+
+import (
+	"bytes"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"os"
+)
+
+type FileSystem interface {
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, data []byte) error
+	FileExists(path string) bool
+	RemoveFile(path string) error
+}
+
+type DefaultFileSystem struct {
+}
+
+func (fs DefaultFileSystem) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// WriteFile leaves a file that already has the given content untouched.
+func (fs DefaultFileSystem) WriteFile(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+
+	return common.WriteFile(path, data)
+}
+
+func (fs DefaultFileSystem) FileExists(path string) bool {
+	return common.FileExists(path)
+}
+
+func (fs DefaultFileSystem) RemoveFile(path string) error {
+	err := os.Remove(path)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// JournalFileSystem remembers the content every file had before it was first changed,
+// so all the changes can be reverted.
+type JournalFileSystem struct {
+	FileSystem
+	original map[string][]byte
+	existed  map[string]bool
+	order    []string
+}
+
+func NewJournalFileSystem(fs FileSystem) *JournalFileSystem {
+	return &JournalFileSystem{
+		FileSystem: fs,
+		original:   map[string][]byte{},
+		existed:    map[string]bool{},
+	}
+}
+
+func (fs *JournalFileSystem) WriteFile(path string, data []byte) error {
+	err := fs.remember(path)
+
+	if err != nil {
+		return err
+	}
+
+	return fs.FileSystem.WriteFile(path, data)
+}
+
+func (fs *JournalFileSystem) RemoveFile(path string) error {
+	err := fs.remember(path)
+
+	if err != nil {
+		return err
+	}
+
+	return fs.FileSystem.RemoveFile(path)
+}
+
+// Changed reports whether any file differs from what it was before the first change.
+func (fs *JournalFileSystem) Changed() bool {
+	for _, path := range fs.order {
+		if fs.existed[path] != fs.FileSystem.FileExists(path) {
+			return true
+		}
+
+		if fs.existed[path] {
+			data, err := fs.FileSystem.ReadFile(path)
+
+			if err != nil || !bytes.Equal(data, fs.original[path]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (fs *JournalFileSystem) Revert() error {
+	for idx := len(fs.order) - 1; idx >= 0; idx-- {
+		path := fs.order[idx]
+
+		var err error
+
+		if fs.existed[path] {
+			err = fs.FileSystem.WriteFile(path, fs.original[path])
+		} else {
+			err = fs.FileSystem.RemoveFile(path)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fs.order = nil
+	return nil
+}
+
+func (fs *JournalFileSystem) remember(path string) error {
+	if _, ok := fs.existed[path]; ok {
+		return nil
+	}
+
+	if fs.FileSystem.FileExists(path) {
+		data, err := fs.FileSystem.ReadFile(path)
+
+		if err != nil {
+			return err
+		}
+
+		fs.original[path] = data
+		fs.existed[path] = true
+	} else {
+		fs.existed[path] = false
+	}
+
+	fs.order = append(fs.order, path)
+	return nil
+}
@@ -7,8 +7,10 @@ import (
 
 type Installation struct {
 	Commander
+	FileSystem
 	param.Params
 	HomeDir
-	ProfileName      string
 	InstallationTime time.Time
+	State            *State
+	DryRun           bool // nothing is changed and nothing is asked
 }
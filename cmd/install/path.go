@@ -9,6 +9,8 @@ import (
 	"time"
 )
 
+const backupTimeFormat = "02-01-2006_15:04:05"
+
 type HomeDir struct {
 	Path string
 }
@@ -27,14 +29,49 @@ func (home HomeDir) KarabinerConfigFile() string {
 }
 
 func (home HomeDir) KarabinerConfigBackupFile(time time.Time) string {
-	currentTime := time.Format("02-01-2006_15:04:05")
+	currentTime := time.Format(backupTimeFormat)
 	return filepath.Join(home.KarabinerConfigDir(), "/karabiner-"+currentTime+".json")
 }
 
+func (home HomeDir) LatestKarabinerConfigBackupFile() (string, bool) {
+	entries, _ := os.ReadDir(home.KarabinerConfigDir())
+
+	var latest string
+	var latestTime time.Time
+
+	for _, e := range entries {
+		name := strings.TrimSuffix(strings.TrimPrefix(e.Name(), "karabiner-"), ".json")
+		backupTime, err := time.Parse(backupTimeFormat, name)
+
+		if err == nil && !backupTime.Before(latestTime) {
+			latest = filepath.Join(home.KarabinerConfigDir(), e.Name())
+			latestTime = backupTime
+		}
+	}
+
+	return latest, latest != ""
+}
+
 func (home HomeDir) KarabinerComplexModificationsDir() string {
 	return filepath.Join(home.Path, ".config/karabiner/assets/complex_modifications")
 }
 
+func (home HomeDir) PcfyConfigDir() string {
+	return filepath.Join(home.Path, ".config/pcfy")
+}
+
+func (home HomeDir) StateFile() string {
+	return filepath.Join(home.PcfyConfigDir(), "state.json")
+}
+
+func (home HomeDir) LogsDir() string {
+	return filepath.Join(home.PcfyConfigDir(), "logs")
+}
+
+func (home HomeDir) LogFile(command string, time time.Time) string {
+	return filepath.Join(home.LogsDir(), command+"-"+time.Format(backupTimeFormat)+".log")
+}
+
 func (home HomeDir) ApplicationSupportDir() string {
 	return filepath.Join(home.Path, "Library/Application Support")
 }
@@ -0,0 +1,143 @@
+package install
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"slices"
+	"time"
+)
+
+// State is the record of an installation, saved to StateFile after a successful run.
+type State struct {
+	Version     string          `json:"version"`
+	InstalledAt time.Time       `json:"installed_at"`
+	Params      param.Params    `json:"params"`
+	Profiles    []string        `json:"profiles"` // Karabiner profiles installed, with other profile-name values too
+	Files       []FileState     `json:"files"`
+	Defaults    []DefaultsState `json:"defaults"`
+	LaunchAgent string          `json:"launch_agent,omitempty"`
+
+	written []string
+	sources map[string]string
+}
+
+type FileState struct {
+	Path     string `json:"path"`
+	Checksum string `json:"sha256"`
+	Source   string `json:"source_sha256,omitempty"` // set when the file was converted after it had been written
+}
+
+type DefaultsState struct {
+	Domain   string  `json:"domain"`
+	Key      string  `json:"key"`
+	Value    string  `json:"value"`
+	Previous *string `json:"previous"` // nil when the key was not set before
+}
+
+func NewState(version string, installedAt time.Time, params param.Params) *State {
+	return &State{
+		Version:     version,
+		InstalledAt: installedAt,
+		Params:      params,
+		Profiles:    []string{params.ProfileName()},
+		Files:       []FileState{},
+		Defaults:    []DefaultsState{},
+	}
+}
+
+func LoadState(fs FileSystem, path string) (*State, error) {
+	data, err := fs.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (s *State) FileWritten(path string, data []byte) {
+	if !slices.Contains(s.written, path) {
+		s.written = append(s.written, path)
+	}
+
+	if s.sources == nil {
+		s.sources = map[string]string{}
+	}
+
+	s.sources[path] = Checksum(data)
+}
+
+func (s *State) WrittenFiles() []string {
+	return s.written
+}
+
+func (s *State) AddFile(path string, data []byte) {
+	file := FileState{Path: path, Checksum: Checksum(data)}
+
+	if source := s.sources[path]; source != file.Checksum {
+		file.Source = source
+	}
+
+	s.Files = append(s.Files, file)
+}
+
+func (s *State) FindFile(path string) (FileState, bool) {
+	for _, f := range s.Files {
+		if f.Path == path {
+			return f, true
+		}
+	}
+
+	return FileState{}, false
+}
+
+func (s *State) AddDefaults(domain, key, value string, previous *string) {
+	s.Defaults = append(s.Defaults, DefaultsState{Domain: domain, Key: key, Value: value, Previous: previous})
+}
+
+func (s *State) FindDefaults(domain, key string) (DefaultsState, bool) {
+	for _, d := range s.Defaults {
+		if d.Domain == domain && d.Key == key {
+			return d, true
+		}
+	}
+
+	return DefaultsState{}, false
+}
+
+func Checksum(data []byte) string {
+	checksum := sha256.Sum256(data)
+	return hex.EncodeToString(checksum[:])
+}
+
+func (s *State) Bytes() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// stateFileSystem reports every written file to the installation state.
+type stateFileSystem struct {
+	FileSystem
+	state *State
+}
+
+func NewStateFileSystem(fs FileSystem, state *State) FileSystem {
+	return stateFileSystem{FileSystem: fs, state: state}
+}
+
+func (fs stateFileSystem) WriteFile(path string, data []byte) error {
+	err := fs.FileSystem.WriteFile(path, data)
+
+	if err == nil {
+		fs.state.FileWritten(path, data)
+	}
+
+	return err
+}
@@ -1,12 +1,15 @@
 package install
 
 import (
-	"errors"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/raxigan/pcfy-my-mac/cmd/common"
 	"github.com/schollz/progressbar/v3"
+	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -23,14 +26,67 @@ func (tp DefaultTimeProvider) Now() time.Time {
 }
 
 type Commander interface {
-	Run(command string)
+	Run(command string) (CommandResult, error)
 	Exit(code int)
 	TryLog(msgType LogMessage, text string)
 }
 
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Duration time.Duration
+}
+
+// CommandError is returned by Commander.Run when a command cannot be started or exits with a non-zero code.
+type CommandError struct {
+	Command string
+	Result  CommandResult
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("Command failed with exit code %d: %s", e.Result.ExitCode, e.Command)
+
+	if stderr := strings.TrimSpace(e.Result.Stderr); stderr != "" {
+		msg += "\n" + stderr
+	}
+
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	TextLogFormat = "text"
+	JsonLogFormat = "json"
+)
+
+var LogFormats = []string{TextLogFormat, JsonLogFormat}
+
+// LogEvent is a single line of the JSON log. Duration is set for commands, in seconds, and for
+// task statuses, where it covers the whole task. DryRun marks what a dry run would have done.
+type LogEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Task      string    `json:"task,omitempty"`
+	Type      string    `json:"type"`
+	Text      string    `json:"text"`
+	Duration  float64   `json:"duration,omitempty"`
+	DryRun    bool      `json:"dry_run,omitempty"`
+}
+
 type DefaultCommander struct {
 	Verbose  bool
+	Format   string
 	Progress *progressbar.ProgressBar
+
+	// Log receives every event as JSON, whatever the format and verbosity of the console output.
+	Log io.Writer
+
+	task      string
+	taskStart time.Time
 }
 
 func NewDefaultCommander(verbose bool) *DefaultCommander {
@@ -40,35 +96,59 @@ func NewDefaultCommander(verbose bool) *DefaultCommander {
 	}
 }
 
-func (c *DefaultCommander) Run(command string) {
+// OpenLog creates the log file, which is kept open until the process exits.
+func (c *DefaultCommander) OpenLog(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	c.Log = file
+	return nil
+}
+
+func (c *DefaultCommander) Run(command string) (CommandResult, error) {
 
 	if command == "clear" {
-		if !c.Verbose {
+		if !c.Verbose && c.Format != JsonLogFormat {
 			clearConsole()
 		}
-		return
+		return CommandResult{}, nil
 	}
 
-	c.TryLog(CmdMsg, command)
+	var stdout, stderr bytes.Buffer
+	cmd := common.ExecCommand("/bin/bash", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
-	var out []byte = nil
-	var err error = nil
+	start := time.Now()
+	err := cmd.Run()
 
-	if strings.HasPrefix(command, "jq") {
-		out, err = exec.Command("/bin/bash", "-c", command).CombinedOutput()
-	} else {
-		out, err = common.ExecCommand("/bin/bash", "-c", command).CombinedOutput()
+	result := CommandResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: -1,
+		Duration: time.Since(start),
 	}
 
-	if !strings.HasPrefix(command, "killall") && err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			c.TryLog(StdErrMsg, string(out))
-			os.Exit(1)
-		}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
 	}
 
-	c.TryLog(StdOutMsg, string(out))
+	c.logEvent(CmdMsg, command, result.Duration)
+	c.TryLog(StdOutMsg, result.Stdout)
+	c.TryLog(StdErrMsg, result.Stderr)
+
+	if err != nil {
+		return result, &CommandError{Command: command, Result: result, Err: err}
+	}
+
+	return result, nil
 }
 
 func clearConsole() {
@@ -87,6 +167,10 @@ var (
 	WarnMsg   = LogMessage{"WARN", common.Yellow}
 	StdOutMsg = LogMessage{"STDOUT", common.Purple}
 	FileMsg   = LogMessage{"FILE", common.Cyan}
+	StatusMsg = LogMessage{"STATUS", common.Blue}
+
+	// ReportMsg is what a command tells the user in the end, e.g. the check results, printed as it is in the text format.
+	ReportMsg = LogMessage{"REPORT", common.Reset}
 
 	ErrMsg    = LogMessage{"ERROR", common.Red}
 	StdErrMsg = LogMessage{"STDERR", common.Red}
@@ -98,10 +182,42 @@ type LogMessage struct {
 }
 
 func (c *DefaultCommander) TryLog(logMsg LogMessage, output string) {
+	c.logEvent(logMsg, output, 0)
+}
+
+func (c *DefaultCommander) logEvent(logMsg LogMessage, output string, duration time.Duration) {
 
 	output = strings.ReplaceAll(output, os.Getenv("HOME"), "~")
 
-	if logMsg.msgType == ErrMsg.msgType || logMsg.msgType == StdErrMsg.msgType {
+	switch logMsg.msgType {
+	case TaskMsg.msgType:
+		c.task = output
+		c.taskStart = time.Now()
+	case StatusMsg.msgType:
+		duration = time.Since(c.taskStart)
+	case ReportMsg.msgType:
+		c.task = ""
+	}
+
+	event := LogEvent{
+		Timestamp: time.Now(),
+		Task:      c.task,
+		Type:      logMsg.msgType,
+		Text:      strings.TrimSuffix(colorCodes.ReplaceAllString(output, ""), "\n"),
+		Duration:  duration.Seconds(),
+	}
+
+	if c.Log != nil && len(output) != 0 {
+		writeEvent(c.Log, event)
+	}
+
+	if c.Format == JsonLogFormat {
+		if len(output) != 0 {
+			writeEvent(os.Stdout, event)
+		}
+	} else if logMsg.msgType == ReportMsg.msgType {
+		fmt.Println(strings.TrimSuffix(output, "\n"))
+	} else if logMsg.msgType == ErrMsg.msgType {
 		log(logMsg, output)
 	} else if !c.Verbose && c.Progress != nil {
 		c.Progress.Add(4)
@@ -110,6 +226,13 @@ func (c *DefaultCommander) TryLog(logMsg LogMessage, output string) {
 	}
 }
 
+var colorCodes = regexp.MustCompile("\033\\[[0-9;]*m")
+
+func writeEvent(w io.Writer, event LogEvent) {
+	line, _ := json.Marshal(event)
+	fmt.Fprintln(w, string(line))
+}
+
 func log(msg LogMessage, output string) {
 
 	isHelper := os.Getenv("GO_WANT_HELPER_PROCESS")
@@ -0,0 +1,474 @@
+package karabiner
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+)
+
+type Config struct {
+	Profiles []Profile `json:"profiles"`
+	Extra    `json:"-"`
+}
+
+type Profile struct {
+	Name                 string                `json:"name"`
+	Selected             *bool                 `json:"selected"`
+	ComplexModifications *ComplexModifications `json:"complex_modifications"`
+	Devices              []Device              `json:"devices"`
+	FnFunctionKeys       []FnFunctionKey       `json:"fn_function_keys"`
+	VirtualHIDKeyboard   *VirtualHIDKeyboard   `json:"virtual_hid_keyboard"`
+	Extra                `json:"-"`
+}
+
+type ComplexModifications struct {
+	Parameters map[string]int `json:"parameters"`
+	Rules      []Rule         `json:"rules"`
+	Extra      `json:"-"`
+}
+
+type Device struct {
+	Identifiers    *DeviceIdentifiers `json:"identifiers"`
+	Ignore         *bool              `json:"ignore"`
+	FnFunctionKeys []FnFunctionKey    `json:"fn_function_keys"`
+	Extra          `json:"-"`
+}
+
+type DeviceIdentifiers struct {
+	VendorID          int    `json:"vendor_id,omitempty"`
+	ProductID         int    `json:"product_id,omitempty"`
+	IsKeyboard        *bool  `json:"is_keyboard"`
+	IsPointingDevice  *bool  `json:"is_pointing_device"`
+	IsBuiltInKeyboard *bool  `json:"is_built_in_keyboard"`
+	Description       string `json:"description,omitempty"`
+	Extra             `json:"-"`
+}
+
+type FnFunctionKey struct {
+	From  *From   `json:"from"`
+	To    []Event `json:"to"`
+	Extra `json:"-"`
+}
+
+type VirtualHIDKeyboard struct {
+	CountryCode                     *int   `json:"country_code"`
+	KeyboardTypeV2                  string `json:"keyboard_type_v2,omitempty"`
+	IndicateStickyModifierKeysState *bool  `json:"indicate_sticky_modifier_keys_state"`
+	MouseKeyXYScale                 *int   `json:"mouse_key_xy_scale"`
+	Extra                           `json:"-"`
+}
+
+type RuleSet struct {
+	Title string `json:"title"`
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	Description  string        `json:"description,omitempty"`
+	Manipulators []Manipulator `json:"manipulators"`
+	Extra        `json:"-"`
+}
+
+type Manipulator struct {
+	Type       string      `json:"type,omitempty"`
+	From       *From       `json:"from"`
+	To         []Event     `json:"to"`
+	ToIfAlone  []Event     `json:"to_if_alone"`
+	Conditions []Condition `json:"conditions"`
+	Extra      `json:"-"`
+}
+
+type From struct {
+	KeyCode         string     `json:"key_code,omitempty"`
+	ConsumerKeyCode string     `json:"consumer_key_code,omitempty"`
+	Modifiers       *Modifiers `json:"modifiers"`
+	Extra           `json:"-"`
+}
+
+type Modifiers struct {
+	Mandatory ModifierList `json:"mandatory"`
+	Optional  ModifierList `json:"optional"`
+	Extra     `json:"-"`
+}
+
+type Event struct {
+	KeyCode                    string       `json:"key_code,omitempty"`
+	ConsumerKeyCode            string       `json:"consumer_key_code,omitempty"`
+	AppleVendorKeyboardKeyCode string       `json:"apple_vendor_keyboard_key_code,omitempty"`
+	ShellCommand               string       `json:"shell_command,omitempty"`
+	Modifiers                  ModifierList `json:"modifiers"`
+	Extra                      `json:"-"`
+}
+
+type Condition struct {
+	Type              string              `json:"type,omitempty"`
+	BundleIdentifiers []string            `json:"bundle_identifiers"`
+	Identifiers       []DeviceIdentifiers `json:"identifiers"`
+	Extra             `json:"-"`
+}
+
+// ModifierList accepts both forms Karabiner allows for modifiers: a single string or an array.
+type ModifierList []string
+
+func (m *ModifierList) UnmarshalJSON(data []byte) error {
+	var single string
+
+	if err := json.Unmarshal(data, &single); err == nil {
+		*m = ModifierList{single}
+		return nil
+	}
+
+	var list []string
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*m = list
+	return nil
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseConfig(data)
+}
+
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func ParseProfile(data []byte) (Profile, error) {
+	profile := Profile{}
+	err := json.Unmarshal(data, &profile)
+	return profile, err
+}
+
+func ParseRuleSet(data []byte) (RuleSet, error) {
+	ruleSet := RuleSet{}
+	err := json.Unmarshal(data, &ruleSet)
+	return ruleSet, err
+}
+
+func (c *Config) Bytes() ([]byte, error) {
+	return marshalIndent(c, "  ")
+}
+
+func (c *Config) Profile(name string) *Profile {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) AddProfile(profile Profile) {
+	c.Profiles = append(c.Profiles, profile)
+}
+
+func (c *Config) DeleteProfile(name string) {
+	var profiles []Profile
+
+	for _, p := range c.Profiles {
+		if p.Name != name {
+			profiles = append(profiles, p)
+		}
+	}
+
+	c.Profiles = append([]Profile{}, profiles...)
+}
+
+func (c *Config) UnselectOtherProfiles(name string) {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name != name {
+			c.Profiles[i].Selected = new(bool)
+		}
+	}
+}
+
+func (c *Config) SelectFirstProfileIfNoneSelected() {
+	for _, p := range c.Profiles {
+		if p.Selected != nil && *p.Selected {
+			return
+		}
+	}
+
+	if len(c.Profiles) > 0 {
+		selected := true
+		c.Profiles[0].Selected = &selected
+	}
+}
+
+func (p *Profile) AddRules(rules ...Rule) {
+	if p.ComplexModifications == nil {
+		p.ComplexModifications = &ComplexModifications{}
+	}
+
+	p.ComplexModifications.Rules = append(p.ComplexModifications.Rules, rules...)
+}
+
+func (p *Profile) RemoveBuiltInKeyboardConditions() {
+	p.ReplaceBuiltInKeyboardConditions(nil)
+}
+
+// ReplaceBuiltInKeyboardConditions replaces the conditions targeting the built-in keyboard with the given
+// one, or just removes them if it is nil.
+func (p *Profile) ReplaceBuiltInKeyboardConditions(replacement *Condition) {
+	if p.ComplexModifications == nil {
+		return
+	}
+
+	for _, rule := range p.ComplexModifications.Rules {
+		for m := range rule.Manipulators {
+			manipulator := &rule.Manipulators[m]
+
+			if manipulator.Conditions == nil {
+				continue
+			}
+
+			conditions := []Condition{}
+
+			for _, c := range manipulator.Conditions {
+				if !c.targetsBuiltInKeyboard() {
+					conditions = append(conditions, c)
+				}
+			}
+
+			if replacement != nil && len(conditions) < len(manipulator.Conditions) {
+				conditions = append(conditions, *replacement)
+			}
+
+			manipulator.Conditions = conditions
+		}
+	}
+}
+
+// ExcludeApps adds bundle identifier patterns to the frontmost_application_unless condition of every
+// manipulator of the rule, adding the condition where there is none.
+func (r *Rule) ExcludeApps(patterns []string) {
+	for m := range r.Manipulators {
+		manipulator := &r.Manipulators[m]
+		i := slices.IndexFunc(manipulator.Conditions, func(c Condition) bool { return c.Type == "frontmost_application_unless" })
+
+		if i < 0 {
+			manipulator.Conditions = append(manipulator.Conditions, Condition{Type: "frontmost_application_unless"})
+			i = len(manipulator.Conditions) - 1
+		}
+
+		condition := &manipulator.Conditions[i]
+
+		for _, p := range patterns {
+			if !slices.Contains(condition.BundleIdentifiers, p) {
+				condition.BundleIdentifiers = append(condition.BundleIdentifiers, p)
+			}
+		}
+	}
+}
+
+// ExcludeAppsAlongside adds bundle identifier patterns to the frontmost_application_unless conditions that already
+// have the given pattern, so that a new app is excluded from the same rules as a similar one. It returns whether
+// any condition was changed.
+func (r *Rule) ExcludeAppsAlongside(existing string, patterns []string) bool {
+	changed := false
+
+	for m := range r.Manipulators {
+		for c := range r.Manipulators[m].Conditions {
+			condition := &r.Manipulators[m].Conditions[c]
+
+			if condition.Type != "frontmost_application_unless" || !slices.Contains(condition.BundleIdentifiers, existing) {
+				continue
+			}
+
+			for _, p := range patterns {
+				if !slices.Contains(condition.BundleIdentifiers, p) {
+					condition.BundleIdentifiers = append(condition.BundleIdentifiers, p)
+					changed = true
+				}
+			}
+		}
+	}
+
+	return changed
+}
+
+func (c Condition) targetsBuiltInKeyboard() bool {
+	for _, id := range c.Identifiers {
+		if id.IsBuiltInKeyboard != nil && *id.IsBuiltInKeyboard {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	extra, err := unmarshalObject(data, (*plain)(c))
+	c.Extra = extra
+	return err
+}
+
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return marshalObject(plain(c), c.Extra)
+}
+
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	type plain Profile
+	extra, err := unmarshalObject(data, (*plain)(p))
+	p.Extra = extra
+	return err
+}
+
+func (p Profile) MarshalJSON() ([]byte, error) {
+	type plain Profile
+	return marshalObject(plain(p), p.Extra)
+}
+
+func (c *ComplexModifications) UnmarshalJSON(data []byte) error {
+	type plain ComplexModifications
+	extra, err := unmarshalObject(data, (*plain)(c))
+	c.Extra = extra
+	return err
+}
+
+func (c ComplexModifications) MarshalJSON() ([]byte, error) {
+	type plain ComplexModifications
+	return marshalObject(plain(c), c.Extra)
+}
+
+func (d *Device) UnmarshalJSON(data []byte) error {
+	type plain Device
+	extra, err := unmarshalObject(data, (*plain)(d))
+	d.Extra = extra
+	return err
+}
+
+func (d Device) MarshalJSON() ([]byte, error) {
+	type plain Device
+	return marshalObject(plain(d), d.Extra)
+}
+
+func (d *DeviceIdentifiers) UnmarshalJSON(data []byte) error {
+	type plain DeviceIdentifiers
+	extra, err := unmarshalObject(data, (*plain)(d))
+	d.Extra = extra
+	return err
+}
+
+func (d DeviceIdentifiers) MarshalJSON() ([]byte, error) {
+	type plain DeviceIdentifiers
+	return marshalObject(plain(d), d.Extra)
+}
+
+func (f *FnFunctionKey) UnmarshalJSON(data []byte) error {
+	type plain FnFunctionKey
+	extra, err := unmarshalObject(data, (*plain)(f))
+	f.Extra = extra
+	return err
+}
+
+func (f FnFunctionKey) MarshalJSON() ([]byte, error) {
+	type plain FnFunctionKey
+	return marshalObject(plain(f), f.Extra)
+}
+
+func (v *VirtualHIDKeyboard) UnmarshalJSON(data []byte) error {
+	type plain VirtualHIDKeyboard
+	extra, err := unmarshalObject(data, (*plain)(v))
+	v.Extra = extra
+	return err
+}
+
+func (v VirtualHIDKeyboard) MarshalJSON() ([]byte, error) {
+	type plain VirtualHIDKeyboard
+	return marshalObject(plain(v), v.Extra)
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	extra, err := unmarshalObject(data, (*plain)(r))
+	r.Extra = extra
+	return err
+}
+
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type plain Rule
+	return marshalObject(plain(r), r.Extra)
+}
+
+func (m *Manipulator) UnmarshalJSON(data []byte) error {
+	type plain Manipulator
+	extra, err := unmarshalObject(data, (*plain)(m))
+	m.Extra = extra
+	return err
+}
+
+func (m Manipulator) MarshalJSON() ([]byte, error) {
+	type plain Manipulator
+	return marshalObject(plain(m), m.Extra)
+}
+
+func (f *From) UnmarshalJSON(data []byte) error {
+	type plain From
+	extra, err := unmarshalObject(data, (*plain)(f))
+	f.Extra = extra
+	return err
+}
+
+func (f From) MarshalJSON() ([]byte, error) {
+	type plain From
+	return marshalObject(plain(f), f.Extra)
+}
+
+func (m *Modifiers) UnmarshalJSON(data []byte) error {
+	type plain Modifiers
+	extra, err := unmarshalObject(data, (*plain)(m))
+	m.Extra = extra
+	return err
+}
+
+func (m Modifiers) MarshalJSON() ([]byte, error) {
+	type plain Modifiers
+	return marshalObject(plain(m), m.Extra)
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	type plain Event
+	extra, err := unmarshalObject(data, (*plain)(e))
+	e.Extra = extra
+	return err
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	type plain Event
+	return marshalObject(plain(e), e.Extra)
+}
+
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	type plain Condition
+	extra, err := unmarshalObject(data, (*plain)(c))
+	c.Extra = extra
+	return err
+}
+
+func (c Condition) MarshalJSON() ([]byte, error) {
+	type plain Condition
+	return marshalObject(plain(c), c.Extra)
+}
+
+func (r *RuleSet) Bytes() ([]byte, error) {
+	return marshalIndent(r, "  ")
+}
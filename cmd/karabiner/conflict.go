@@ -0,0 +1,113 @@
+package karabiner
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// Overlaps tells if a key press can trigger both events. Karabiner only applies the first
+// matching manipulator, so whichever comes second never fires for that press.
+func (f *From) Overlaps(other *From) bool {
+	if f == nil || other == nil || f.key() == "" || f.key() != other.key() {
+		return false
+	}
+
+	return f.allows(other.mandatory()) && other.allows(f.mandatory())
+}
+
+func (f *From) String() string {
+	return strings.Join(append(slices.Clone(f.mandatory()), f.key()), " + ")
+}
+
+func (f *From) key() string {
+	if f.ConsumerKeyCode != "" {
+		return f.ConsumerKeyCode
+	}
+
+	return f.KeyCode
+}
+
+func (f *From) mandatory() ModifierList {
+	if f.Modifiers == nil {
+		return nil
+	}
+
+	return f.Modifiers.Mandatory
+}
+
+// allows tells if pressing the given modifiers along with the key still matches the event.
+func (f *From) allows(modifiers ModifierList) bool {
+	var accepted ModifierList
+
+	if f.Modifiers != nil {
+		accepted = append(slices.Clone(f.Modifiers.Mandatory), f.Modifiers.Optional...)
+	}
+
+	for _, m := range modifiers {
+		if !slices.ContainsFunc(accepted, func(a string) bool { return sameModifier(a, m) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameModifier tells if two modifiers can be the same key, e.g. command and left_command, or left_alt and left_option.
+func sameModifier(a, b string) bool {
+	a, b = cmp.Or(modifierAliases[a], a), cmp.Or(modifierAliases[b], b)
+
+	if a == "any" || b == "any" || a == b {
+		return true
+	}
+
+	sideless := func(m string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(m, "left_"), "right_")
+	}
+
+	return sideless(a) == sideless(b) && (sideless(a) == a || sideless(b) == b)
+}
+
+// Overlaps returns the first event of the rule that overlaps an event of the other rule under conditions
+// that can hold at the same time.
+func (r *Rule) Overlaps(other Rule) *From {
+	for _, m := range r.Manipulators {
+		for _, o := range other.Manipulators {
+			if m.From.Overlaps(o.From) && !excludeEachOther(m.Conditions, o.Conditions) {
+				return m.From
+			}
+		}
+	}
+
+	return nil
+}
+
+func excludeEachOther(conditions, others []Condition) bool {
+	for _, c := range conditions {
+		for _, o := range others {
+			if c.excludes(o) || o.excludes(c) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// excludes tells if the frontmost app conditions never hold together: an _if condition and an _unless one
+// covering all of its bundle identifiers, or two _if conditions with no bundle identifier in common. Bundle
+// identifiers are compared as written, not as regexes.
+func (c Condition) excludes(other Condition) bool {
+	if c.Type != "frontmost_application_if" || len(c.BundleIdentifiers) == 0 {
+		return false
+	}
+
+	switch other.Type {
+	case "frontmost_application_unless":
+		return !slices.ContainsFunc(c.BundleIdentifiers, func(id string) bool { return !slices.Contains(other.BundleIdentifiers, id) })
+	case "frontmost_application_if":
+		return !slices.ContainsFunc(c.BundleIdentifiers, func(id string) bool { return slices.Contains(other.BundleIdentifiers, id) })
+	}
+
+	return false
+}
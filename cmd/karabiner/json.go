@@ -0,0 +1,96 @@
+package karabiner
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Extra keeps the fields of a Karabiner object that the model does not know about,
+// so that they survive a load and save round trip untouched.
+type Extra map[string]json.RawMessage
+
+func unmarshalObject(data []byte, v any) (Extra, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, name := range jsonFieldNames(reflect.TypeOf(v).Elem()) {
+		delete(fields, name)
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return fields, nil
+}
+
+func marshalObject(v any, extra Extra) ([]byte, error) {
+	data, err := marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name, value := range fields {
+		if string(value) == "null" {
+			delete(fields, name)
+		}
+	}
+
+	for name, value := range extra {
+		fields[name] = value
+	}
+
+	return marshal(fields)
+}
+
+func marshal(v any) ([]byte, error) {
+	return marshalIndent(v, "")
+}
+
+func marshalIndent(v any, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	if indent == "" {
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,89 @@
+package karabiner
+
+import (
+	"fmt"
+	"slices"
+)
+
+// KeyCodes are the key_code values Karabiner-Elements accepts in from and to events.
+var KeyCodes = keyCodes()
+
+// ModifierNames are the modifiers Karabiner-Elements accepts in from and to events.
+var ModifierNames = []string{
+	"caps_lock",
+	"command", "left_command", "right_command",
+	"control", "left_control", "right_control",
+	"option", "left_option", "right_option",
+	"shift", "left_shift", "right_shift",
+	"fn",
+	"left_alt", "right_alt", "left_gui", "right_gui",
+}
+
+// modifierAliases are the other names Karabiner-Elements accepts for the option and command keys.
+var modifierAliases = map[string]string{
+	"left_alt":  "left_option",
+	"right_alt": "right_option",
+	"left_gui":  "left_command",
+	"right_gui": "right_command",
+}
+
+func keyCodes() []string {
+	codes := []string{
+		"return_or_enter", "escape", "delete_or_backspace", "delete_forward", "tab", "spacebar",
+		"hyphen", "equal_sign", "open_bracket", "close_bracket", "backslash", "non_us_pound", "semicolon", "quote",
+		"grave_accent_and_tilde", "comma", "period", "slash", "non_us_backslash", "caps_lock",
+		"print_screen", "scroll_lock", "pause", "insert", "home", "page_up", "end", "page_down",
+		"right_arrow", "left_arrow", "down_arrow", "up_arrow",
+		"keypad_num_lock", "keypad_slash", "keypad_asterisk", "keypad_hyphen", "keypad_plus", "keypad_enter",
+		"keypad_period", "keypad_equal_sign", "keypad_comma",
+		"application", "power", "execute", "help", "menu", "select", "stop", "again", "undo", "cut", "copy", "paste", "find",
+		"mute", "volume_decrement", "volume_increment",
+		"left_control", "left_shift", "left_option", "left_command",
+		"right_control", "right_shift", "right_option", "right_command", "fn",
+		"left_alt", "right_alt", "left_gui", "right_gui",
+		"display_brightness_decrement", "display_brightness_increment", "mission_control", "launchpad", "dashboard",
+		"illumination_decrement", "illumination_increment", "rewind", "play_or_pause", "fastforward",
+		"japanese_eisuu", "japanese_kana",
+	}
+
+	for c := 'a'; c <= 'z'; c++ {
+		codes = append(codes, string(c))
+	}
+
+	for n := 0; n <= 9; n++ {
+		codes = append(codes, fmt.Sprint(n), fmt.Sprintf("keypad_%d", n))
+	}
+
+	for n := 1; n <= 24; n++ {
+		codes = append(codes, fmt.Sprintf("f%d", n))
+	}
+
+	for n := 1; n <= 9; n++ {
+		codes = append(codes, fmt.Sprintf("lang%d", n), fmt.Sprintf("international%d", n))
+	}
+
+	return codes
+}
+
+func IsKeyCode(code string) bool {
+	return slices.Contains(KeyCodes, code)
+}
+
+func IsModifier(modifier string) bool {
+	return slices.Contains(ModifierNames, modifier)
+}
+
+// KeyEvent is the to event sending a key code, consumer key code or Apple vendor keyboard key code. Names that
+// are also legacy key codes, like mission_control or play_or_pause, get the consumer or Apple vendor form.
+func KeyEvent(name string) (Event, bool) {
+	switch {
+	case slices.Contains(AppleVendorKeyboardKeyCodes, name):
+		return Event{AppleVendorKeyboardKeyCode: name}, true
+	case slices.Contains(ConsumerKeyCodes, name):
+		return Event{ConsumerKeyCode: name}, true
+	case IsKeyCode(name):
+		return Event{KeyCode: name}, true
+	}
+
+	return Event{}, false
+}
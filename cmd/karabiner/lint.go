@@ -0,0 +1,290 @@
+package karabiner
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LintError is a problem Karabiner-Elements would reject or silently ignore, at a JSONPath of the linted document.
+type LintError struct {
+	Path    string
+	Message string
+}
+
+func (e LintError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+var ConsumerKeyCodes = []string{
+	"power", "display_brightness_increment", "display_brightness_decrement", "fast_forward", "rewind",
+	"scan_next_track", "scan_previous_track", "eject", "play_or_pause", "mute", "volume_increment", "volume_decrement",
+	"dictation", "menu", "help", "voice_command", "al_terminal_lock_or_screensaver", "al_word_processor",
+	"al_text_editor", "al_spreadsheet", "al_graphics_editor", "al_presentation_app", "al_database_app",
+	"al_email_reader", "al_voicemail", "al_address_book", "al_calendar_or_schedule", "al_task_or_project_manager",
+	"al_network_chat", "al_local_machine_browser", "al_internet_browser", "al_keyboard_layout", "al_calculator",
+	"al_audio_player", "ac_search", "ac_home", "ac_back", "ac_forward", "ac_stop", "ac_refresh", "ac_bookmarks",
+	"ac_zoom_in", "ac_zoom_out",
+}
+
+var AppleVendorKeyboardKeyCodes = []string{
+	"spotlight", "dashboard", "function", "launchpad", "expose_all", "expose_desktop",
+	"brightness_up", "brightness_down", "language", "mission_control",
+}
+
+var ManipulatorTypes = []string{"basic", "mouse_motion_to_scroll"}
+
+var ConditionTypes = []string{
+	"frontmost_application_if", "frontmost_application_unless",
+	"device_if", "device_unless", "device_exists_if", "device_exists_unless",
+	"keyboard_type_if", "keyboard_type_unless",
+	"input_source_if", "input_source_unless",
+	"variable_if", "variable_unless",
+	"event_changed_if", "event_changed_unless",
+	"expression_if", "expression_unless",
+}
+
+var manipulatorFields = []string{
+	"type", "description", "from", "to", "to_if_alone", "to_if_held_down", "to_after_key_up",
+	"to_delayed_action", "conditions", "parameters",
+}
+
+var toEventFields = []string{"to", "to_if_alone", "to_if_held_down", "to_after_key_up"}
+
+// Lint checks the complex modification rules of a rule file, a profile or a whole Karabiner config.
+func Lint(data []byte) ([]LintError, error) {
+	var doc any
+
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	l := &linter{}
+	root, ok := doc.(map[string]any)
+
+	if !ok {
+		l.fail("$", "expected an object")
+		return l.errors, nil
+	}
+
+	switch {
+	case root["rules"] != nil:
+		l.rules("$.rules", root["rules"])
+	case root["profiles"] != nil:
+		for n, profile := range l.array("$.profiles", root["profiles"]) {
+			l.profile(fmt.Sprintf("$.profiles[%d]", n), profile)
+		}
+	case root["complex_modifications"] != nil:
+		l.profile("$", root)
+	default:
+		l.fail("$", "expected rules, profiles or complex_modifications")
+	}
+
+	return l.errors, nil
+}
+
+type linter struct {
+	errors []LintError
+}
+
+func (l *linter) fail(path, format string, a ...any) {
+	l.errors = append(l.errors, LintError{path, fmt.Sprintf(format, a...)})
+}
+
+func (l *linter) object(path string, v any) map[string]any {
+	object, ok := v.(map[string]any)
+
+	if !ok {
+		l.fail(path, "expected an object")
+	}
+
+	return object
+}
+
+func (l *linter) array(path string, v any) []any {
+	array, ok := v.([]any)
+
+	if !ok {
+		l.fail(path, "expected an array")
+	}
+
+	return array
+}
+
+func (l *linter) profile(path string, v any) {
+	profile := l.object(path, v)
+
+	if modifications, found := profile["complex_modifications"]; found {
+		if rules, found := l.object(path+".complex_modifications", modifications)["rules"]; found {
+			l.rules(path+".complex_modifications.rules", rules)
+		}
+	}
+}
+
+func (l *linter) rules(path string, v any) {
+	for n, r := range l.array(path, v) {
+		rulePath := fmt.Sprintf("%s[%d]", path, n)
+		rule := l.object(rulePath, r)
+
+		if _, found := rule["description"]; !found {
+			l.fail(rulePath, "missing description")
+		}
+
+		manipulators, found := rule["manipulators"]
+
+		if !found {
+			l.fail(rulePath, "missing manipulators")
+			continue
+		}
+
+		for m, manipulator := range l.array(rulePath+".manipulators", manipulators) {
+			l.manipulator(fmt.Sprintf("%s.manipulators[%d]", rulePath, m), manipulator)
+		}
+	}
+}
+
+func (l *linter) manipulator(path string, v any) {
+	manipulator := l.object(path, v)
+
+	for _, field := range sortedKeys(manipulator) {
+		if !slices.Contains(manipulatorFields, field) {
+			l.fail(path+"."+field, "unknown field")
+		}
+	}
+
+	if t, _ := manipulator["type"].(string); !slices.Contains(ManipulatorTypes, t) {
+		l.fail(path+".type", "unknown manipulator type %q", manipulator["type"])
+	}
+
+	if from, found := manipulator["from"]; found {
+		l.from(path+".from", from)
+	} else {
+		l.fail(path, "missing from")
+	}
+
+	for _, field := range toEventFields {
+		if events, found := manipulator[field]; found {
+			l.events(path+"."+field, events)
+		}
+	}
+
+	if conditions, found := manipulator["conditions"]; found {
+		for n, condition := range l.array(path+".conditions", conditions) {
+			l.condition(fmt.Sprintf("%s.conditions[%d]", path, n), condition)
+		}
+	}
+}
+
+func (l *linter) from(path string, v any) {
+	from := l.object(path, v)
+	l.keyCodes(path, from)
+
+	if modifiers, found := from["modifiers"]; found {
+		object := l.object(path+".modifiers", modifiers)
+
+		for _, field := range []string{"mandatory", "optional"} {
+			if list, found := object[field]; found {
+				l.modifiers(path+".modifiers."+field, list, field == "optional")
+			}
+		}
+	}
+}
+
+// events accepts both a single event and an array of events, as Karabiner-Elements does.
+func (l *linter) events(path string, v any) {
+	if event, ok := v.(map[string]any); ok {
+		l.event(path, event)
+		return
+	}
+
+	for n, event := range l.array(path, v) {
+		l.event(fmt.Sprintf("%s[%d]", path, n), event)
+	}
+}
+
+func (l *linter) event(path string, v any) {
+	event := l.object(path, v)
+	l.keyCodes(path, event)
+
+	if modifiers, found := event["modifiers"]; found {
+		l.modifiers(path+".modifiers", modifiers, false)
+	}
+}
+
+func (l *linter) keyCodes(path string, event map[string]any) {
+	l.name(path, event, "key_code", KeyCodes)
+	l.name(path, event, "consumer_key_code", ConsumerKeyCodes)
+	l.name(path, event, "apple_vendor_keyboard_key_code", AppleVendorKeyboardKeyCodes)
+}
+
+func (l *linter) name(path string, object map[string]any, field string, valid []string) {
+	v, found := object[field]
+
+	if !found {
+		return
+	}
+
+	if name, _ := v.(string); !slices.Contains(valid, name) {
+		l.fail(path+"."+field, "unknown %s %q", strings.ReplaceAll(field, "_", " "), v)
+	}
+}
+
+// modifiers accepts both a single modifier and an array of them, as Karabiner-Elements does.
+func (l *linter) modifiers(path string, v any, optional bool) {
+	list, ok := v.([]any)
+
+	if name, isString := v.(string); isString {
+		list, ok = []any{name}, true
+	}
+
+	if !ok {
+		l.fail(path, "expected a modifier or an array of modifiers")
+		return
+	}
+
+	for n, m := range list {
+		name, _ := m.(string)
+
+		if !IsModifier(name) && !(optional && name == "any") {
+			l.fail(fmt.Sprintf("%s[%d]", path, n), "unknown modifier %q", m)
+		}
+	}
+}
+
+func (l *linter) condition(path string, v any) {
+	condition := l.object(path, v)
+
+	if t, _ := condition["type"].(string); !slices.Contains(ConditionTypes, t) {
+		l.fail(path+".type", "unknown condition type %q", condition["type"])
+	}
+
+	for _, field := range []string{"bundle_identifiers", "file_paths"} {
+		patterns, found := condition[field]
+
+		if !found {
+			continue
+		}
+
+		for n, p := range l.array(path+"."+field, patterns) {
+			pattern, _ := p.(string)
+
+			if _, err := regexp.Compile(pattern); err != nil {
+				l.fail(fmt.Sprintf("%s.%s[%d]", path, field, n), "invalid regex %q: %s", p, err)
+			}
+		}
+	}
+}
+
+func sortedKeys(object map[string]any) []string {
+	var keys []string
+
+	for k := range object {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
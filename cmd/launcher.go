@@ -1,41 +1,227 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
 	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
 	"github.com/raxigan/pcfy-my-mac/cmd/param"
 	"github.com/raxigan/pcfy-my-mac/cmd/task"
+	"io"
+	"os"
+	"slices"
 )
 
-func Launch(homeDir install.HomeDir, commander install.Commander, tp install.TimeProvider, params param.Params) error {
+// Version is the version of the tool recorded in the installation state.
+var Version string
 
-	installation := install.Installation{
+// TaskGroups limits an installation to some of the task groups, see task.Groups.
+type TaskGroups struct {
+	Only []string
+	Skip []string
+}
+
+func Launch(homeDir install.HomeDir, commander install.Commander, tp install.TimeProvider, params param.Params, groups TaskGroups) error {
+
+	err := InstallGroups(newInstallation(homeDir, commander, install.DefaultFileSystem{}, tp, params), groups)
+
+	if err != nil {
+		return err
+	}
+
+	commander.TryLog(install.ReportMsg, "PC'fied")
+	commander.Run("clear")
+	commander.TryLog(install.ReportMsg, `
+Almost ready!
+
+1. Restart the tools (if any) you installed the keymaps for, and then select
+   the new keymap "PCfy" in settings.
+2. Grant appropriate system permissions to the following tools when prompted:
+ • Karabiner-Elements
+ • Alt-Tab
+ • Rectangle`)
+
+	return nil
+}
+
+func LaunchUninstall(homeDir install.HomeDir, commander install.Commander, tp install.TimeProvider) error {
+
+	err := Uninstall(newInstallation(homeDir, commander, install.DefaultFileSystem{}, tp, InstalledParams(homeDir)))
+
+	if err != nil {
+		return err
+	}
+
+	commander.TryLog(install.ReportMsg, "Un-PC'fied")
+	return nil
+}
+
+func Doctor(homeDir install.HomeDir, commander install.Commander, tp install.TimeProvider) error {
+
+	i := newInstallation(homeDir, commander, install.DefaultFileSystem{}, tp, InstalledParams(homeDir))
+	failed := 0
+
+	for _, check := range task.Checks() {
+		commander.TryLog(install.ReportMsg, check.Name)
+
+		for _, result := range check.Run(i) {
+			commander.TryLog(install.ReportMsg, fmt.Sprintf(" [%s] %s: %s", common.Colored(checkColors[result.Status], string(result.Status)), result.Name, result.Message))
+
+			if result.Fix != "" {
+				commander.TryLog(install.ReportMsg, "        Fix: "+result.Fix)
+			}
+
+			if result.Status == task.Fail {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+
+	return nil
+}
+
+// Validate lints the bundled Karabiner rule files and the given ones, as Karabiner-Elements ignores invalid rules silently.
+func Validate(files []string, commander install.Commander) error {
+	problems, err := task.LintBundledKarabinerFiles()
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+
+		if err != nil {
+			return err
+		}
+
+		problems = append(problems, task.LintKarabinerFile(file, data)...)
+	}
+
+	for _, p := range problems {
+		commander.TryLog(install.ReportMsg, p)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found", len(problems))
+	}
+
+	commander.TryLog(install.ReportMsg, "No problems found")
+	return nil
+}
+
+// ExportRules writes the rules selected by the parameters to a complex_modifications file, or prints them
+// when no path is given.
+func ExportRules(homeDir install.HomeDir, commander install.Commander, params param.Params, path string) error {
+
+	ruleSet, warnings, err := task.ExportRules(newInstallation(homeDir, commander, install.DefaultFileSystem{}, install.DefaultTimeProvider{}, params))
+
+	if err != nil {
+		return err
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+
+	data, err := ruleSet.Bytes()
+
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		commander.TryLog(install.ReportMsg, string(data))
+		return nil
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	commander.TryLog(install.ReportMsg, fmt.Sprintf("Exported %d rules to %s", len(ruleSet.Rules), path))
+	return nil
+}
+
+var checkColors = map[task.CheckStatus]string{
+	task.Pass: common.Green,
+	task.Warn: common.Yellow,
+	task.Fail: common.Red,
+}
+
+func DryRun(homeDir install.HomeDir, tp install.TimeProvider, params param.Params, log io.Writer, format string, run func(i install.Installation) error) error {
+
+	commander := install.NewDryRunCommander()
+	commander.Log = log
+	commander.Format = format
+	i := newInstallation(homeDir, commander, install.NewDryRunFileSystem(), tp, params)
+	i.DryRun = true
+
+	err := run(i)
+	commander.PrintPlan()
+
+	return err
+}
+
+// InstalledParams returns the parameters of the latest installation, so that uninstall and doctor
+// target the profile it installed.
+func InstalledParams(homeDir install.HomeDir) param.Params {
+	state, err := install.LoadState(install.DefaultFileSystem{}, homeDir.StateFile())
+
+	if err != nil {
+		return param.Params{}
+	}
+
+	return state.Params
+}
+
+// KarabinerConfig returns the current Karabiner config, whose keyboards the survey asks about, or nil if there is none.
+func KarabinerConfig(homeDir install.HomeDir, fs install.FileSystem) *karabiner.Config {
+	data, err := fs.ReadFile(homeDir.KarabinerConfigFile())
+
+	if err != nil {
+		return nil
+	}
+
+	config, err := karabiner.ParseConfig(data)
+
+	if err != nil {
+		return nil
+	}
+
+	return config
+}
+
+func newInstallation(homeDir install.HomeDir, commander install.Commander, fs install.FileSystem, tp install.TimeProvider, params param.Params) install.Installation {
+	state := install.NewState(Version, tp.Now(), params)
+
+	return install.Installation{
 		Commander:        commander,
+		FileSystem:       install.NewStateFileSystem(fs, state),
 		HomeDir:          homeDir,
 		Params:           params,
-		ProfileName:      "PCfy",
 		InstallationTime: tp.Now(),
+		State:            state,
 	}
-
-	return Install(installation)
 }
 
 func Install(i install.Installation) error {
+	return InstallGroups(i, TaskGroups{})
+}
+
+func InstallGroups(i install.Installation, groups TaskGroups) error {
 
 	tasks := []task.Task{
+		task.ValidateKarabinerRules(),
 		task.DownloadDependencies(),
-		task.CloseKarabiner(),
-		task.BackupKarabinerConfig(),
-		task.DeleteExistingKarabinerProfile(),
-		task.CreateKarabinerProfile(),
-		task.NameKarabinerProfile(),
-		task.UnselectOtherKarabinerProfiles(),
-		task.ApplyTerminalRules(),
-		task.ApplyMainKarabinerRules(),
-		task.ApplyAppLauncherRules(),
-		task.ApplyKeyboardLayoutRules(),
-		task.ReformatKarabinerConfigFile(),
-		task.OpenKarabiner(),
+		task.InstallKarabinerRuleFiles(),
+		task.UpdateKarabinerConfig(),
+		task.InstallAppLauncherPreferences(),
 		task.CopyIdeKeymaps(),
 		task.CloseRectangle(),
 		task.CopyRectanglePreferences(),
@@ -46,29 +232,90 @@ func Install(i install.Installation) error {
 		task.ApplySystemSettings(),
 		task.CopyHidutilRemappingFile(),
 		task.ExecuteHidutil(),
+		task.SaveInstallationState(),
+	}
+
+	selected, err := task.Select(tasks, groups.Only, groups.Skip)
+
+	if err != nil {
+		return err
+	}
+
+	return runTasks(i, tasks, selected)
+}
+
+func Uninstall(i install.Installation) error {
+
+	tasks := []task.Task{
+		task.RemoveKarabinerProfile(),
+		task.RemoveKarabinerRuleFiles(),
+		task.RemoveIdeKeymaps(),
+		task.RevertSystemSettings(),
+		task.RemoveHidutilRemappingFile(),
+		task.ResetHidutil(),
+		task.RemoveInstallationState(),
 	}
 
+	return runTasks(i, tasks, tasks)
+}
+
+// runTasks runs the selected tasks in order and reports for each of the tasks whether it changed anything.
+func runTasks(i install.Installation, tasks []task.Task, selected []task.Task) error {
+	var done []executedTask
+
 	for _, t := range tasks {
 		i.Commander.TryLog(install.TaskMsg, t.Name)
 
-		err := t.Execute(i)
+		if !slices.ContainsFunc(selected, func(s task.Task) bool { return s.Name == t.Name }) {
+			i.Commander.TryLog(install.StatusMsg, string(task.Skipped))
+			continue
+		}
 
-		if err != nil {
-			return err
+		if t.UpToDate != nil {
+			upToDate, err := t.UpToDate(i)
+
+			if err != nil {
+				return rollback(done, err)
+			}
+
+			if upToDate {
+				i.Commander.TryLog(install.StatusMsg, string(task.Unchanged))
+				continue
+			}
 		}
-	}
 
-	fmt.Println("PC'fied")
-	i.Commander.Run("clear")
-	fmt.Println(`
-Almost ready!
+		journal := install.NewJournalFileSystem(i.FileSystem)
+		commander := &countingCommander{Commander: i.Commander}
+		ti := i
+		ti.FileSystem = journal
+		ti.Commander = commander
 
-1. Restart the tools (if any) you installed the keymaps for, and then select
-   the new keymap "PCfy" in settings.
-2. Grant appropriate system permissions to the following tools when prompted:
- • Karabiner-Elements
- • Alt-Tab
- • Rectangle`)
+		err := t.Execute(ti)
+		done = append(done, executedTask{t, ti, journal})
+
+		status := task.Unchanged
+
+		if errors.Is(err, task.ErrSkipped) {
+			status = task.Skipped
+		} else if err != nil {
+			return rollback(done, err)
+		} else if journal.Changed() || commander.commands > 0 {
+			status = task.Changed
+		}
+
+		i.Commander.TryLog(install.StatusMsg, string(status))
+	}
 
 	return nil
 }
+
+// countingCommander counts the commands a task runs, as every command is taken for a change.
+type countingCommander struct {
+	install.Commander
+	commands int
+}
+
+func (c *countingCommander) Run(command string) (install.CommandResult, error) {
+	c.commands++
+	return c.Commander.Run(command)
+}
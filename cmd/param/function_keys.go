@@ -0,0 +1,43 @@
+package param
+
+import (
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"sort"
+)
+
+var FunctionKeys = []string{"f1", "f2", "f3", "f4", "f5", "f6", "f7", "f8", "f9", "f10", "f11", "f12"}
+
+// ValidateFunctionKeys checks the function-keys parameter and the custom-function-keys map, which maps F-keys to the
+// key code, consumer key code or Apple vendor keyboard key code they send. The map is only used with function-keys: custom.
+func ValidateFunctionKeys(mode *string, custom map[string]string) error {
+	if mode != nil {
+		if err := ValidateParamValues("function-keys", &[]string{*mode}, []string{Standard, Media, Custom}); err != nil {
+			return err
+		}
+	}
+
+	if len(custom) == 0 {
+		return nil
+	}
+
+	var keys []string
+
+	for key := range custom {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := ValidateParamValues("custom-function-keys", &[]string{key}, FunctionKeys); err != nil {
+			return err
+		}
+
+		if _, found := karabiner.KeyEvent(custom[key]); !found {
+			return fmt.Errorf("Invalid param 'custom-function-keys' %s: unknown key code '%s'", key, custom[key])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package param
+
+import (
+	"fmt"
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"strings"
+)
+
+// Keyboard sets the layout of a single external keyboard, overriding keyboard-layout for it.
+type Keyboard struct {
+	VendorID    int    `yaml:"vendor-id" json:"vendor-id"`
+	ProductID   int    `yaml:"product-id" json:"product-id"`
+	Layout      string `yaml:"layout" json:"layout"`
+	Description string `yaml:"description" json:"description,omitempty"`
+}
+
+func (k Keyboard) Name() string {
+	if k.Description != "" {
+		return k.Description
+	}
+
+	return fmt.Sprintf("vendor_id %d, product_id %d", k.VendorID, k.ProductID)
+}
+
+func ValidateKeyboards(keyboards *[]Keyboard) error {
+	if keyboards == nil {
+		return nil
+	}
+
+	for n, k := range *keyboards {
+		if k.VendorID <= 0 || k.ProductID <= 0 {
+			return fmt.Errorf("Invalid param 'keyboards' keyboard %d: vendor-id and product-id are required", n+1)
+		}
+
+		if err := ValidateParamValues("keyboards", &[]string{k.Layout}, []string{PC, Mac}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findKeyboards lists the external keyboards Karabiner-Elements has settings for in any of the profiles of the config.
+func findKeyboards(config *karabiner.Config) []Keyboard {
+	if config == nil {
+		return nil
+	}
+
+	var keyboards []Keyboard
+	found := map[[2]int]bool{}
+
+	for _, p := range config.Profiles {
+		for _, d := range p.Devices {
+			id := d.Identifiers
+
+			if id == nil || id.IsKeyboard == nil || !*id.IsKeyboard || id.VendorID == 0 || found[[2]int{id.VendorID, id.ProductID}] {
+				continue
+			}
+
+			if id.IsBuiltInKeyboard != nil && *id.IsBuiltInKeyboard {
+				continue
+			}
+
+			found[[2]int{id.VendorID, id.ProductID}] = true
+			keyboards = append(keyboards, Keyboard{VendorID: id.VendorID, ProductID: id.ProductID, Description: id.Description})
+		}
+	}
+
+	return keyboards
+}
+
+// askKeyboardLayouts asks for the layout of each keyboard, defaulting to the keyboard-layout answer.
+func askKeyboardLayouts(keyboards []Keyboard, keyboardLayout string) []Keyboard {
+	defaultLayout := PC
+
+	if strings.EqualFold(keyboardLayout, Mac) {
+		defaultLayout = Mac
+	}
+
+	var result []Keyboard
+
+	for _, k := range keyboards {
+		layout := ""
+
+		common.HandleInterrupt(survey.AskOne(&survey.Select{
+			Message: fmt.Sprintf("Specify the layout of keyboard %s:", k.Name()),
+			Options: []string{PC, Mac},
+			Default: defaultLayout,
+			Help:    `Found in your Karabiner-Elements settings. The Opt/Cmd swap is only applied to Mac layout keyboards`,
+		}, &layout))
+
+		k.Layout = layout
+		result = append(result, k)
+	}
+
+	return result
+}
@@ -0,0 +1,99 @@
+package param
+
+import (
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"slices"
+	"strings"
+)
+
+// AppLauncher is an app the Win key opens when tapped alone. Its rules are generated from the
+// karabiner/app-launcher.json template.
+type AppLauncher struct {
+	Name            string // value of the app-launcher param and survey option
+	Title           string // name in the rule descriptions
+	Apps            []string
+	Key             []karabiner.Event // sent when Win is tapped alone, the launcher's hotkey
+	PreferenceFiles []PreferenceFile
+	Defaults        []LauncherDefaults
+}
+
+// PreferenceFile is a preferences asset setting the launcher's hotkey to the key sent.
+type PreferenceFile struct {
+	Asset string
+	Dir   string // relative to homedir, may contain {alfred-preferences} and {alfred-local-hash}
+	Entry string // if set, only this entry of the asset is merged into an existing file
+}
+
+// LauncherDefaults is a defaults key setting the launcher's hotkey to the key sent.
+type LauncherDefaults struct {
+	Domain string
+	Key    string
+	Type   string
+	Value  string
+}
+
+var optionSpacebar = []karabiner.Event{{KeyCode: "spacebar", Modifiers: karabiner.ModifierList{"option"}}}
+
+var AppLaunchers = []AppLauncher{
+	{Name: Spotlight, Title: "Spotlight", Key: []karabiner.Event{{AppleVendorKeyboardKeyCode: "spotlight"}}},
+	{Name: Launchpad, Title: "Launchpad", Key: []karabiner.Event{{AppleVendorKeyboardKeyCode: "launchpad"}}},
+	{
+		Name:  Alfred,
+		Title: "Alfred",
+		Apps:  []string{"Alfred 4.app", "Alfred 5.app"},
+		Key:   optionSpacebar,
+		PreferenceFiles: []PreferenceFile{
+			{Asset: "alfred/prefs.plist", Dir: "{alfred-preferences}/preferences/local/{alfred-local-hash}/hotkey", Entry: "default"},
+		},
+	},
+	{
+		Name:     Raycast,
+		Title:    "Raycast",
+		Apps:     []string{"Raycast.app"},
+		Key:      optionSpacebar,
+		Defaults: []LauncherDefaults{{"com.raycast.macos", "raycastGlobalHotkey", "string", "Option-49"}},
+	},
+	// Win only acts as Cmd
+	{Name: None, Title: "No app launcher"},
+}
+
+// AppLauncherOptions are the valid values of the app-launcher param.
+func AppLauncherOptions() []string {
+	var options []string
+
+	for _, l := range AppLaunchers {
+		options = append(options, l.Name)
+	}
+
+	return options
+}
+
+func AppLauncherByName(name string) (AppLauncher, bool) {
+	for _, l := range AppLaunchers {
+		if strings.EqualFold(l.Name, name) {
+			return l, true
+		}
+	}
+
+	return AppLauncher{}, false
+}
+
+// RuleFile is the name of the rule file installed for the launcher, e.g. alfred.json.
+func (l AppLauncher) RuleFile() string {
+	return ToSimpleParamName(l.Title) + ".json"
+}
+
+// WinDescription is what the Win rule does in its description, e.g. Open Alfred.
+func (l AppLauncher) WinDescription() string {
+	if len(l.Key) == 0 {
+		return l.Title
+	}
+
+	return "Open " + l.Title
+}
+
+// Installed tells if any of the launcher apps is installed. Launchers shipped with macOS have none.
+func (l AppLauncher) Installed() bool {
+	return len(l.Apps) == 0 || slices.ContainsFunc(l.Apps, common.Exists)
+}
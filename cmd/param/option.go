@@ -8,6 +8,7 @@ const (
 	Spotlight = "Spotlight"
 	Launchpad = "Launchpad"
 	Alfred    = "Alfred"
+	Raycast   = "Raycast"
 
 	Default = "Default"
 	ITerm   = "iTerm"
@@ -17,6 +18,15 @@ const (
 	PC   = "PC"
 	Mac  = "Mac"
 	None = "None"
+
+	Standard = "Standard"
+	Media    = "Media"
+	Custom   = "Custom"
+
+	InstallBoth = "Install both"
+	KeepUser    = "Keep user"
+	KeepPcfy    = "Keep PCfy"
+	Ask         = "Ask"
 )
 
 type IDE struct {
@@ -93,6 +103,69 @@ var SystemSettings = []string{
 	"Show full POSIX paths in Finder window title",
 }
 
+// KarabinerRule identifies a rule of the bundled main.json and finder.json files, so that it can be
+// left out with the karabiner-rules parameter. IDs must not change once released.
+type KarabinerRule struct {
+	ID          string
+	File        string
+	Description string
+}
+
+var KarabinerRules = []KarabinerRule{
+	{"ctrl-left-arrow", "main.json", "Ctrl + Left Arrow"},
+	{"ctrl-shift-left-arrow", "main.json", "Ctrl + Shift + Left Arrow"},
+	{"ctrl-right-arrow", "main.json", "Ctrl + Right Arrow"},
+	{"ctrl-shift-right-arrow", "main.json", "Ctrl + Shift + Right Arrow"},
+	{"alt-f4", "main.json", "Alt + F4"},
+	{"win-l-lock-screen", "main.json", "Win + L (Lock Screen)"},
+	{"ctrl-backspace", "main.json", "Ctrl + Backspace"},
+	{"f3-select-next-occurrence", "main.json", "F3 (Select next occurrence)"},
+	{"f5-reload-page", "main.json", "F5 (Reload page)"},
+	{"ctrl-h-browser-history", "main.json", "Ctrl + H (Browser history)"},
+	{"intellij-preferences-fix", "main.json", "IntelliJ Preferences fix"},
+	{"intellij-vcs-operations-fix", "main.json", "IntelliJ VCS Operations fix"},
+	{"intellij-vcs-show-history-fix", "main.json", "IntelliJ VCS Operations fix (Show History)"},
+	{"intellij-vcs-annotate-fix", "main.json", "IntelliJ VCS Operations fix (Annotate with Git Blame)"},
+	{"intellij-vcs-show-diff-fix", "main.json", "IntelliJ VCS Operations fix (Show Diff)"},
+	{"disable-default-app-switcher", "main.json", "Disable default app switcher"},
+	{"disable-ctrl-q-quit-app", "main.json", "Disable Ctrl + Q (Quit app)"},
+	{"finder-enter-to-open", "finder.json", "Enter to open file/directory in Finder"},
+	{"finder-fn-return-to-rename", "finder.json", "Use Return as Open and Use Fn+Return as Rename"},
+	{"finder-f2-to-rename", "finder.json", "F2 to rename in Finder"},
+	{"finder-delete-to-trash", "finder.json", "Delete to move to Trash in Finder"},
+	{"finder-fn-delete-to-trash", "finder.json", "Fn + Delete to move to Trash in Finder"},
+}
+
+func KarabinerRuleIds() []string {
+	var ids []string
+
+	for _, r := range KarabinerRules {
+		ids = append(ids, r.ID)
+	}
+
+	return ids
+}
+
+func KarabinerRuleOptions() []string {
+	var options []string
+
+	for _, r := range KarabinerRules {
+		options = append(options, r.Description)
+	}
+
+	return options
+}
+
+func KarabinerRuleByDescription(description string) (KarabinerRule, error) {
+	for _, r := range KarabinerRules {
+		if r.Description == description {
+			return r, nil
+		}
+	}
+
+	return KarabinerRule{}, errors.New("No Karabiner rule found: " + description)
+}
+
 func IdeKeymapOptions() []string {
 
 	var options []string
@@ -4,31 +4,65 @@ import (
 	"errors"
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
 	"gopkg.in/yaml.v3"
 	"slices"
 	"strings"
 )
 
+const DefaultProfileName = "PCfy"
+
 type Params struct {
-	AppLauncher    string
-	Terminal       string
-	KeyboardLayout string
-	Keymaps        []string
-	SystemSettings []string
-	Blacklist      []string
+	Preset              string               `json:"preset,omitempty"`
+	AppLauncher         string               `json:"app-launcher"`
+	Terminal            string               `json:"terminal"`
+	CustomTerminal      *CustomTerminal      `json:"custom-terminal,omitempty"`
+	KeyboardLayout      string               `json:"keyboard-layout"`
+	Keymaps             []string             `json:"keymaps"`
+	SystemSettings      []string             `json:"system-settings"`
+	Blacklist           []string             `json:"blacklist"`
+	CustomRules         []CustomRule         `json:"custom-rules,omitempty"`
+	ExcludedRules       []string             `json:"excluded-karabiner-rules,omitempty"`
+	Profile             string               `json:"profile-name,omitempty"`
+	SelectProfile       *bool                `json:"select-profile,omitempty"`
+	Keyboards           []Keyboard           `json:"keyboards,omitempty"`
+	ExcludedApps        []string             `json:"excluded-apps,omitempty"`
+	RuleConflicts       string               `json:"rule-conflicts,omitempty"`
+	KarabinerParameters *KarabinerParameters `json:"karabiner-parameters,omitempty"`
+	FunctionKeys        string               `json:"function-keys,omitempty"`
+	CustomFunctionKeys  map[string]string    `json:"custom-function-keys,omitempty"`
 }
 
 type FileParams struct {
-	AppLauncher    *string `yaml:"app-launcher"`
-	Terminal       *string
-	KeyboardLayout *string `yaml:"keyboard-layout"`
-	Keymaps        *[]string
-	SystemSettings *[]string `yaml:"system-settings"`
-	Blacklist      *[]string
-	Extra          map[string]string `yaml:",inline"`
+	Preset              *string `yaml:"preset"`
+	AppLauncher         *string `yaml:"app-launcher"`
+	Terminal            *TerminalParam
+	KeyboardLayout      *string `yaml:"keyboard-layout"`
+	Keymaps             *[]string
+	SystemSettings      *[]string `yaml:"system-settings"`
+	Blacklist           *[]string
+	CustomRules         *[]CustomRule         `yaml:"custom-rules"`
+	KarabinerRules      *KarabinerRulesParams `yaml:"karabiner-rules"`
+	ProfileName         *string               `yaml:"profile-name"`
+	SelectProfile       *bool                 `yaml:"select-profile"`
+	Keyboards           *[]Keyboard
+	ExcludedApps        *[]string            `yaml:"excluded-apps"`
+	RuleConflicts       *string              `yaml:"rule-conflicts"`
+	KarabinerParameters *KarabinerParameters `yaml:"karabiner-parameters"`
+	FunctionKeys        *string              `yaml:"function-keys"`
+	CustomFunctionKeys  map[string]string    `yaml:"custom-function-keys"`
+	Extra               map[string]string    `yaml:",inline"`
+
+	fromFile bool
+}
+
+type KarabinerRulesParams struct {
+	Exclude []string `yaml:"exclude"`
 }
 
-func CollectParams(paramsFile string) (Params, error) {
+// CollectParams reads the params file, if any, and asks for the params it lacks. The keyboards of karabinerConfig,
+// the current Karabiner config or nil, are asked for unless the file has keyboards.
+func CollectParams(paramsFile string, karabinerConfig *karabiner.Config) (Params, error) {
 	fileParams := FileParams{}
 
 	if paramsFile != "" {
@@ -45,7 +79,7 @@ func CollectParams(paramsFile string) (Params, error) {
 		}
 	}
 
-	return CollectSurveyParams(fileParams), nil
+	return CollectSurveyParams(fileParams, karabinerConfig), nil
 }
 
 func CollectYamlParams(yml string) (FileParams, error) {
@@ -65,19 +99,22 @@ func CollectYamlParams(yml string) (FileParams, error) {
 
 	validationErr := ValidateAll(
 		func() error {
-			if fp.AppLauncher != nil {
-				return ValidateParamValues("app-launcher", &[]string{*fp.AppLauncher}, []string{Spotlight, Launchpad, Alfred, None})
+			if fp.Preset != nil {
+				return ValidateParamValues("preset", &[]string{*fp.Preset}, PresetOptions())
 			}
 
 			return nil
 		},
 		func() error {
-			if fp.Terminal != nil {
-				return ValidateParamValues("terminal", &[]string{*fp.Terminal}, []string{Default, ITerm, Warp, Wave, None})
+			if fp.AppLauncher != nil {
+				return ValidateParamValues("app-launcher", &[]string{*fp.AppLauncher}, AppLauncherOptions())
 			}
 
 			return nil
 		},
+		func() error {
+			return ValidateTerminal(fp.Terminal)
+		},
 		func() error {
 			if fp.KeyboardLayout != nil {
 				return ValidateParamValues("keyboard-layout", &[]string{*fp.KeyboardLayout}, []string{PC, Mac, None})
@@ -91,6 +128,42 @@ func CollectYamlParams(yml string) (FileParams, error) {
 		func() error {
 			return ValidateParamValues("system-settings", fp.SystemSettings, SystemSettings)
 		},
+		func() error {
+			return ValidateCustomRules(fp.CustomRules)
+		},
+		func() error {
+			return ValidateKeyboards(fp.Keyboards)
+		},
+		func() error {
+			return ValidateBundleIdPatterns("excluded-apps", fp.ExcludedApps)
+		},
+		func() error {
+			return ValidateKarabinerParameters(fp.KarabinerParameters)
+		},
+		func() error {
+			return ValidateFunctionKeys(fp.FunctionKeys, fp.CustomFunctionKeys)
+		},
+		func() error {
+			if fp.RuleConflicts != nil {
+				return ValidateParamValues("rule-conflicts", &[]string{*fp.RuleConflicts}, slices.Clone(RuleConflictOptions))
+			}
+
+			return nil
+		},
+		func() error {
+			if fp.ProfileName != nil && strings.TrimSpace(*fp.ProfileName) == "" {
+				return errors.New("Invalid param 'profile-name': the name must not be empty")
+			}
+
+			return nil
+		},
+		func() error {
+			if fp.KarabinerRules != nil {
+				return ValidateParamValues("karabiner-rules", &fp.KarabinerRules.Exclude, KarabinerRuleIds())
+			}
+
+			return nil
+		},
 	)
 
 	if validationErr != nil {
@@ -98,18 +171,46 @@ func CollectYamlParams(yml string) (FileParams, error) {
 	}
 
 	return FileParams{
-		AppLauncher:    fp.AppLauncher,
-		Terminal:       fp.Terminal,
-		KeyboardLayout: fp.KeyboardLayout,
-		Keymaps:        fp.Keymaps,
-		SystemSettings: fp.SystemSettings,
-		Blacklist:      fp.Blacklist,
+		Preset:              fp.Preset,
+		AppLauncher:         fp.AppLauncher,
+		Terminal:            fp.Terminal,
+		KeyboardLayout:      fp.KeyboardLayout,
+		Keymaps:             fp.Keymaps,
+		SystemSettings:      fp.SystemSettings,
+		Blacklist:           fp.Blacklist,
+		CustomRules:         fp.CustomRules,
+		KarabinerRules:      fp.KarabinerRules,
+		ProfileName:         fp.ProfileName,
+		SelectProfile:       fp.SelectProfile,
+		Keyboards:           fp.Keyboards,
+		ExcludedApps:        fp.ExcludedApps,
+		RuleConflicts:       fp.RuleConflicts,
+		KarabinerParameters: fp.KarabinerParameters,
+		FunctionKeys:        fp.FunctionKeys,
+		CustomFunctionKeys:  fp.CustomFunctionKeys,
+		fromFile:            true,
 	}, nil
 }
 
-func CollectSurveyParams(fileParams FileParams) Params {
+func CollectSurveyParams(fileParams FileParams, karabinerConfig *karabiner.Config) Params {
 
-	questionsToAsk := questions
+	preset := common.GetOrDefaultString("", fileParams.Preset)
+
+	if fileParams.Preset == nil && fileParams.fromFile {
+		preset = None
+	} else if fileParams.Preset == nil {
+		common.HandleInterrupt(survey.AskOne(presetQuestion.Prompt, &preset))
+	}
+
+	if p, found := PresetByName(preset); found {
+		fileParams = fileParams.withPreset(p)
+	}
+
+	if fileParams.fromFile {
+		fileParams = fileParams.withFileDefaults()
+	}
+
+	questionsToAsk := slices.Clone(questions)
 
 	fp := Params{}
 
@@ -119,6 +220,8 @@ func CollectSurveyParams(fileParams FileParams) Params {
 		"keyboardLayout": fileParams.KeyboardLayout != nil,
 		"keymaps":        fileParams.Keymaps != nil,
 		"systemSettings": fileParams.SystemSettings != nil,
+		"functionKeys":   fileParams.FunctionKeys != nil,
+		"excludedRules":  fileParams.KarabinerRules != nil,
 	}
 
 	for k, v := range qNameToIfShouldNotBeAsked {
@@ -145,16 +248,117 @@ func CollectSurveyParams(fileParams FileParams) Params {
 		}
 	}
 
+	if !qNameToIfShouldNotBeAsked["excludedRules"] {
+		questionsToAsk = append(questionsToAsk,
+			&survey.Question{
+				Name: "excludedRules",
+				Prompt: &survey.MultiSelect{
+					Message:  "Select Karabiner rules NOT to install:",
+					Options:  KarabinerRuleOptions(),
+					Help:     `All the rules are installed by default. Select the ones that clash with your workflows`,
+					PageSize: 15,
+				},
+			},
+		)
+	}
+
 	common.HandleInterrupt(survey.Ask(questionsToAsk, &fp, survey.WithRemoveSelectAll(), survey.WithRemoveSelectNone(), survey.WithKeepFilter(false)))
 
+	terminal, customTerminal := terminalParam(fp.Terminal, fileParams.Terminal)
+	keyboardLayout := common.GetOrDefaultString(fp.KeyboardLayout, fileParams.KeyboardLayout)
+	var keyboards []Keyboard
+
+	if fileParams.Keyboards != nil {
+		keyboards = *fileParams.Keyboards
+	} else if !strings.EqualFold(keyboardLayout, None) {
+		keyboards = askKeyboardLayouts(findKeyboards(karabinerConfig), keyboardLayout)
+	}
+
 	return Params{
-		AppLauncher:    common.GetOrDefaultString(fp.AppLauncher, fileParams.AppLauncher),
-		Terminal:       common.GetOrDefaultString(fp.Terminal, fileParams.Terminal),
-		KeyboardLayout: common.GetOrDefaultString(fp.KeyboardLayout, fileParams.KeyboardLayout),
-		Keymaps:        common.GetOrDefaultSlice(fp.Keymaps, fileParams.Keymaps),
-		Blacklist:      common.GetOrDefaultSlice(fp.Blacklist, fileParams.Blacklist),
-		SystemSettings: common.GetOrDefaultSlice(fp.SystemSettings, fileParams.SystemSettings),
+		Preset:              preset,
+		AppLauncher:         common.GetOrDefaultString(fp.AppLauncher, fileParams.AppLauncher),
+		Terminal:            terminal,
+		CustomTerminal:      customTerminal,
+		KeyboardLayout:      keyboardLayout,
+		Keymaps:             common.GetOrDefaultSlice(fp.Keymaps, fileParams.Keymaps),
+		Blacklist:           common.GetOrDefaultSlice(fp.Blacklist, fileParams.Blacklist),
+		SystemSettings:      common.GetOrDefaultSlice(fp.SystemSettings, fileParams.SystemSettings),
+		CustomRules:         customRules(fileParams.CustomRules),
+		ExcludedRules:       excludedKarabinerRules(fp.ExcludedRules, fileParams.KarabinerRules),
+		Profile:             common.GetOrDefaultString("", fileParams.ProfileName),
+		SelectProfile:       fileParams.SelectProfile,
+		Keyboards:           keyboards,
+		ExcludedApps:        common.GetOrDefaultSlice(nil, fileParams.ExcludedApps),
+		RuleConflicts:       common.GetOrDefaultString(Ask, fileParams.RuleConflicts),
+		KarabinerParameters: fileParams.KarabinerParameters,
+		FunctionKeys:        common.GetOrDefaultString(fp.FunctionKeys, fileParams.FunctionKeys),
+		CustomFunctionKeys:  fileParams.CustomFunctionKeys,
+	}
+}
+
+// withFileDefaults fills the params a params file may lack, as they were added after the older params files had been
+// written, in with their defaults, so that installs from a params file are not stopped by their survey questions.
+func (fp FileParams) withFileDefaults() FileParams {
+	if fp.FunctionKeys == nil {
+		functionKeys := Standard
+		fp.FunctionKeys = &functionKeys
+	}
+
+	if fp.KarabinerRules == nil {
+		fp.KarabinerRules = &KarabinerRulesParams{}
+	}
+
+	if fp.Keyboards == nil {
+		fp.Keyboards = &[]Keyboard{}
+	}
+
+	if fp.RuleConflicts == nil {
+		resolution := InstallBoth
+		fp.RuleConflicts = &resolution
+	}
+
+	return fp
+}
+
+// ProfileName is the name of the Karabiner profile to install, PCfy unless set with profile-name.
+func (p Params) ProfileName() string {
+	if p.Profile == "" {
+		return DefaultProfileName
+	}
+
+	return p.Profile
+}
+
+// ProfileSelected tells if the installed profile becomes the selected one, which it does unless select-profile is false.
+func (p Params) ProfileSelected() bool {
+	return p.SelectProfile == nil || *p.SelectProfile
+}
+
+// RuleConflictOptions are the valid values of the rule-conflicts param. Installs from the survey ask for every conflict,
+// the ones from a params file install both rules unless it is set in the file.
+var RuleConflictOptions = []string{InstallBoth, KeepUser, KeepPcfy, Ask}
+
+// RuleConflictResolution is how PCfy rules overlapping user rules are installed, InstallBoth unless set with rule-conflicts.
+func (p Params) RuleConflictResolution() string {
+	if p.RuleConflicts == "" {
+		return InstallBoth
 	}
+
+	return p.RuleConflicts
+}
+
+// SelectedTerminal is the terminal the Ctrl+Alt+T rule opens: the custom terminal, or else the registered one of the terminal param.
+func (p Params) SelectedTerminal() (Terminal, bool) {
+	if p.CustomTerminal != nil {
+		return p.CustomTerminal.Terminal(), true
+	}
+
+	return TerminalByName(p.Terminal)
+}
+
+// SelectedPreset is the desktop environment preset of the preset param, if any.
+func (p Params) SelectedPreset() (Preset, bool) {
+	return PresetByName(p.Preset)
 }
 
 func ToSimpleParamName(name string) string {
@@ -174,3 +378,28 @@ func findIdes() []string {
 
 	return ides
 }
+
+func customRules(rules *[]CustomRule) []CustomRule {
+	if rules == nil {
+		return nil
+	}
+
+	return *rules
+}
+
+// excludedKarabinerRules returns the IDs of the rules excluded in the params file, or else of the ones selected in the survey.
+func excludedKarabinerRules(selected []string, fileParam *KarabinerRulesParams) []string {
+	if fileParam != nil {
+		return fileParam.Exclude
+	}
+
+	var ids []string
+
+	for _, description := range selected {
+		if rule, err := KarabinerRuleByDescription(description); err == nil {
+			ids = append(ids, rule.ID)
+		}
+	}
+
+	return ids
+}
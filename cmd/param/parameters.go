@@ -0,0 +1,90 @@
+package param
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// KarabinerParameters are the complex modification parameters and virtual keyboard settings of the installed profile.
+// The ones not set keep the Karabiner-Elements defaults.
+type KarabinerParameters struct {
+	ToIfAloneTimeout       *int           `yaml:"to-if-alone-timeout" json:"to-if-alone-timeout,omitempty"`
+	ToIfHeldDownThreshold  *int           `yaml:"to-if-held-down-threshold" json:"to-if-held-down-threshold,omitempty"`
+	ToDelayedActionDelay   *int           `yaml:"to-delayed-action-delay" json:"to-delayed-action-delay,omitempty"`
+	SimultaneousThreshold  *int           `yaml:"simultaneous-threshold" json:"simultaneous-threshold,omitempty"`
+	MouseMotionScrollSpeed *int           `yaml:"mouse-motion-to-scroll-speed" json:"mouse-motion-to-scroll-speed,omitempty"`
+	KeyboardType           *string        `yaml:"keyboard-type" json:"keyboard-type,omitempty"`
+	CountryCode            *int           `yaml:"country-code" json:"country-code,omitempty"`
+	MouseKeyXYScale        *int           `yaml:"mouse-key-xy-scale" json:"mouse-key-xy-scale,omitempty"`
+	StickyModifiersState   *bool          `yaml:"indicate-sticky-modifier-keys-state" json:"indicate-sticky-modifier-keys-state,omitempty"`
+	Extra                  map[string]any `yaml:",inline" json:"-"`
+}
+
+var KeyboardTypes = []string{"ansi", "iso", "jis"}
+
+type parameterRange struct {
+	name     string
+	value    *int
+	min, max int
+}
+
+func (p KarabinerParameters) ranges() []parameterRange {
+	return []parameterRange{
+		{"to-if-alone-timeout", p.ToIfAloneTimeout, 100, 5000},
+		{"to-if-held-down-threshold", p.ToIfHeldDownThreshold, 100, 5000},
+		{"to-delayed-action-delay", p.ToDelayedActionDelay, 100, 5000},
+		{"simultaneous-threshold", p.SimultaneousThreshold, 10, 1000},
+		{"mouse-motion-to-scroll-speed", p.MouseMotionScrollSpeed, 1, 1000},
+		{"country-code", p.CountryCode, 0, 255},
+		{"mouse-key-xy-scale", p.MouseKeyXYScale, 1, 1000},
+	}
+}
+
+// ComplexModifications maps the parameters set to the keys of complex_modifications.parameters.
+func (p KarabinerParameters) ComplexModifications() map[string]int {
+	parameters := map[string]int{}
+
+	for key, value := range map[string]*int{
+		"basic.to_if_alone_timeout_milliseconds":       p.ToIfAloneTimeout,
+		"basic.to_if_held_down_threshold_milliseconds": p.ToIfHeldDownThreshold,
+		"basic.to_delayed_action_delay_milliseconds":   p.ToDelayedActionDelay,
+		"basic.simultaneous_threshold_milliseconds":    p.SimultaneousThreshold,
+		"mouse_motion_to_scroll.speed":                 p.MouseMotionScrollSpeed,
+	} {
+		if value != nil {
+			parameters[key] = *value
+		}
+	}
+
+	return parameters
+}
+
+func ValidateKarabinerParameters(p *KarabinerParameters) error {
+	if p == nil {
+		return nil
+	}
+
+	if len(p.Extra) > 0 {
+		var fields []string
+
+		for field := range p.Extra {
+			fields = append(fields, field)
+		}
+
+		sort.Strings(fields)
+		return errors.New("Unknown parameter: karabiner-parameters." + fields[0])
+	}
+
+	for _, r := range p.ranges() {
+		if r.value != nil && (*r.value < r.min || *r.value > r.max) {
+			return fmt.Errorf("Invalid param 'karabiner-parameters' %s '%d', valid range: %d-%d", r.name, *r.value, r.min, r.max)
+		}
+	}
+
+	if p.KeyboardType != nil {
+		return ValidateParamValues("karabiner-parameters", &[]string{*p.KeyboardType}, KeyboardTypes)
+	}
+
+	return nil
+}
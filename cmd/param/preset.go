@@ -0,0 +1,194 @@
+package param
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// Preset is a bundle of params matching the shortcuts of a desktop environment. The params set in the params
+// file override the ones of the preset, but for the custom rules, which are installed along with the preset ones.
+type Preset struct {
+	Name            string
+	AppLauncher     string
+	Terminal        string
+	FunctionKeys    string
+	SystemSettings  []string
+	ExcludedRules   []string // IDs of the bundled rules the desktop has no counterpart for
+	CustomRules     []CustomRule
+	RunDialog       bool                // Alt + F2 opens the app launcher
+	WindowShortcuts map[string]Shortcut // Rectangle actions, e.g. leftHalf
+	AltTab          map[string]string   // AltTab preferences
+}
+
+// Shortcut is a Rectangle shortcut: a macOS virtual key code and the modifier flags of an NSEvent.
+type Shortcut struct {
+	KeyCode   int
+	Modifiers int
+}
+
+const (
+	optionFlag  = 1 << 19
+	commandFlag = 1 << 20
+
+	keyF10        = 109
+	keyPageUp     = 116
+	keyLeftArrow  = 123
+	keyRightArrow = 124
+	keyDownArrow  = 125
+	keyUpArrow    = 126
+)
+
+// superArrows are the Win + arrows shortcuts of Windows and GNOME: snap to halves, maximize and restore.
+var superArrows = map[string]Shortcut{
+	"leftHalf":  {keyLeftArrow, commandFlag},
+	"rightHalf": {keyRightArrow, commandFlag},
+	"maximize":  {keyUpArrow, commandFlag},
+	"restore":   {keyDownArrow, commandFlag},
+}
+
+func openFinderRule(modifier string) CustomRule {
+	return CustomRule{
+		Description: modifier + " + E (Open Finder)",
+		From:        Key{KeyCode: "e", Modifiers: []string{"left_command"}},
+		To:          Key{KeyCode: "spacebar", Modifiers: []string{"left_command", "left_option"}},
+	}
+}
+
+// runDialogRule opens the app launcher with Alt + F2 by sending its hotkey, or Spotlight's when there is no launcher.
+func runDialogRule(appLauncher string) CustomRule {
+	to := Key{KeyCode: "spacebar", Modifiers: []string{"left_command"}}
+
+	if l, found := AppLauncherByName(appLauncher); found && len(l.Key) > 0 {
+		key := l.Key[0]
+		to = Key{KeyCode: cmp.Or(key.KeyCode, key.ConsumerKeyCode, key.AppleVendorKeyboardKeyCode), Modifiers: key.Modifiers}
+	}
+
+	return CustomRule{
+		Description: "Alt + F2 (Run dialog)",
+		From:        Key{KeyCode: "f2", Modifiers: []string{"option"}},
+		To:          to,
+	}
+}
+
+var Presets = []Preset{
+	{
+		Name:            "GNOME",
+		AppLauncher:     Spotlight,
+		Terminal:        Default,
+		FunctionKeys:    Standard,
+		SystemSettings:  []string{"Enable Dock auto-hide (2s delay)", "Enable Home and End keys", "Show directories on top in Finder"},
+		CustomRules:     []CustomRule{openFinderRule("Super")},
+		RunDialog:       true,
+		WindowShortcuts: superArrows,
+		AltTab:          map[string]string{"spacesToShow": "1"},
+	},
+	{
+		Name:           "KDE",
+		AppLauncher:    Launchpad,
+		Terminal:       Default,
+		FunctionKeys:   Standard,
+		SystemSettings: []string{"Enable Home and End keys", "Show directories on top in Finder", "Show full POSIX paths in Finder window title"},
+		CustomRules:    []CustomRule{openFinderRule("Meta")},
+		RunDialog:      true,
+		WindowShortcuts: map[string]Shortcut{
+			"leftHalf":   {keyLeftArrow, commandFlag},
+			"rightHalf":  {keyRightArrow, commandFlag},
+			"topHalf":    {keyUpArrow, commandFlag},
+			"bottomHalf": {keyDownArrow, commandFlag},
+			"maximize":   {keyPageUp, commandFlag},
+		},
+		AltTab: map[string]string{"spacesToShow": "1"},
+	},
+	{
+		Name:            "Windows",
+		AppLauncher:     Spotlight,
+		Terminal:        None,
+		FunctionKeys:    Standard,
+		SystemSettings:  []string{"Enable Home and End keys", "Show directories on top in Finder"},
+		CustomRules:     []CustomRule{openFinderRule("Win")},
+		WindowShortcuts: superArrows,
+		AltTab:          map[string]string{"spacesToShow": "1", "theme": "1"},
+	},
+	{
+		Name:           "Xfce",
+		AppLauncher:    Launchpad,
+		Terminal:       Default,
+		FunctionKeys:   Standard,
+		SystemSettings: []string{"Enable Home and End keys", "Show directories on top in Finder", "Show full POSIX paths in Finder window title"},
+		ExcludedRules:  []string{"win-l-lock-screen"},
+		CustomRules: []CustomRule{{
+			Description: "Ctrl + Alt + L (Lock Screen)",
+			From:        Key{KeyCode: "l", Modifiers: []string{"left_control", "option"}},
+			To:          Key{KeyCode: "q", Modifiers: []string{"left_command", "left_control"}},
+		}},
+		RunDialog: true,
+		WindowShortcuts: map[string]Shortcut{
+			"leftHalf":   {keyLeftArrow, commandFlag},
+			"rightHalf":  {keyRightArrow, commandFlag},
+			"topHalf":    {keyUpArrow, commandFlag},
+			"bottomHalf": {keyDownArrow, commandFlag},
+			"maximize":   {keyF10, optionFlag},
+		},
+		AltTab: map[string]string{"spacesToShow": "1"},
+	},
+}
+
+// PresetOptions are the valid values of the preset param.
+func PresetOptions() []string {
+	var options []string
+
+	for _, p := range Presets {
+		options = append(options, p.Name)
+	}
+
+	return append(options, None)
+}
+
+func PresetByName(name string) (Preset, bool) {
+	for _, p := range Presets {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+
+	return Preset{}, false
+}
+
+// withPreset fills the params not set in the params file in with the ones of the preset.
+func (fp FileParams) withPreset(p Preset) FileParams {
+	if fp.AppLauncher == nil {
+		fp.AppLauncher = &p.AppLauncher
+	}
+
+	if fp.Terminal == nil {
+		fp.Terminal = &TerminalParam{Name: p.Terminal}
+	}
+
+	if fp.FunctionKeys == nil {
+		fp.FunctionKeys = &p.FunctionKeys
+	}
+
+	if fp.SystemSettings == nil {
+		settings := slices.Clone(p.SystemSettings)
+		fp.SystemSettings = &settings
+	}
+
+	if fp.KarabinerRules == nil {
+		fp.KarabinerRules = &KarabinerRulesParams{Exclude: slices.Clone(p.ExcludedRules)}
+	}
+
+	return fp
+}
+
+// Rules are the custom rules of the preset, with the one opening the app launcher with Alt + F2 if it has a run dialog.
+// They are installed along with the custom rules of the params.
+func (p Preset) Rules(appLauncher string) []CustomRule {
+	rules := slices.Clone(p.CustomRules)
+
+	if p.RunDialog {
+		rules = append(rules, runDialogRule(appLauncher))
+	}
+
+	return rules
+}
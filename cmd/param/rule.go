@@ -0,0 +1,68 @@
+package param
+
+import (
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"strings"
+)
+
+// CustomRule is a key remap defined in the custom-rules section of the params file.
+type CustomRule struct {
+	Description  string   `yaml:"description" json:"description,omitempty"`
+	From         Key      `yaml:"from" json:"from"`
+	To           Key      `yaml:"to" json:"to"`
+	Apps         []string `yaml:"apps" json:"apps,omitempty"`
+	ExcludedApps []string `yaml:"excluded-apps" json:"excluded-apps,omitempty"`
+}
+
+type Key struct {
+	KeyCode   string   `yaml:"key" json:"key"`
+	Modifiers []string `yaml:"modifiers" json:"modifiers,omitempty"`
+}
+
+func (k Key) String() string {
+	return strings.Join(append(append([]string{}, k.Modifiers...), k.KeyCode), "+")
+}
+
+// Name is the rule description, or the remapped keys when there is none.
+func (r CustomRule) Name() string {
+	if r.Description != "" {
+		return r.Description
+	}
+
+	return r.From.String() + " to " + r.To.String()
+}
+
+func ValidateCustomRules(rules *[]CustomRule) error {
+	if rules == nil {
+		return nil
+	}
+
+	for n, rule := range *rules {
+		for _, key := range []struct {
+			name string
+			Key
+		}{{"from", rule.From}, {"to", rule.To}} {
+			if key.KeyCode == "" {
+				return fmt.Errorf("Invalid param 'custom-rules' rule %d: missing %s key", n+1, key.name)
+			}
+
+			if _, found := karabiner.KeyEvent(key.KeyCode); !found || key.name == "from" && !karabiner.IsKeyCode(key.KeyCode) {
+				return fmt.Errorf("Invalid param 'custom-rules' rule %d: unknown key code '%s'", n+1, key.KeyCode)
+			}
+
+			for _, modifier := range key.Modifiers {
+				if !karabiner.IsModifier(modifier) {
+					return fmt.Errorf("Invalid param 'custom-rules' rule %d: unknown modifier '%s', valid modifiers:\n%s",
+						n+1, modifier, strings.Join(karabiner.ModifierNames, "\n"))
+				}
+			}
+		}
+
+		if len(rule.Apps) > 0 && len(rule.ExcludedApps) > 0 {
+			return fmt.Errorf("Invalid param 'custom-rules' rule %d: use either apps or excluded-apps", n+1)
+		}
+	}
+
+	return nil
+}
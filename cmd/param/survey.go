@@ -4,12 +4,22 @@ import (
 	"github.com/AlecAivazis/survey/v2"
 )
 
+// presetQuestion is asked first, as the preset answers some of the questions.
+var presetQuestion = &survey.Question{
+	Name: "preset",
+	Prompt: &survey.Select{
+		Message: "Select the desktop environment you are used to:",
+		Options: PresetOptions(),
+		Help:    `A preset sets up the shortcuts, window tiling and app switcher the way the desktop has them. Select "None" to answer every question`,
+	},
+}
+
 var questions = []*survey.Question{
 	{
 		Name: "appLauncher",
 		Prompt: &survey.Select{
 			Message: "Assign Win/Opt key action (open app launcher):",
-			Options: []string{Spotlight, Launchpad, Alfred, None},
+			Options: AppLauncherOptions(),
 			Help:    `Select you application launcher which will be available under Win/Opt. Select "None" if you don't use any'`,
 		},
 	},
@@ -17,7 +27,7 @@ var questions = []*survey.Question{
 		Name: "terminal",
 		Prompt: &survey.Select{
 			Message: "Assign Ctrl+Alt+T/Ctrl+Cmd+T shortcut action (open terminal):",
-			Options: []string{Default, ITerm, Warp, Wave, None},
+			Options: TerminalOptions(),
 			Help:    `On Linux systems Ctrl+Alt+T starts the default terminal. Let me take care of that or select "None"`,
 		},
 	},
@@ -29,6 +39,14 @@ var questions = []*survey.Question{
 			Help:    `The layout of your external keyboard to help adjust the setup. If you do not use any, just select "None"`,
 		},
 	},
+	{
+		Name: "functionKeys",
+		Prompt: &survey.Select{
+			Message: "Select what the F1, F2, etc. keys do when pressed without Fn:",
+			Options: []string{Standard, Media},
+			Help:    `Shortcuts like F2 (rename) and F5 (reload) need standard function keys. With "Media", press Fn to use them`,
+		},
+	},
 	{
 		Name: "systemSettings",
 		Prompt: &survey.MultiSelect{
@@ -0,0 +1,120 @@
+package param
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// Terminal is a terminal app the Ctrl+Alt+T shortcut can open. Its rule is generated from the karabiner/terminal.json template.
+type Terminal struct {
+	Name     string // value of the terminal param and survey option
+	Title    string // name in the rule description
+	App      string
+	BundleID string
+	Args     []string
+	Builtin  bool // ships with macOS, so it is never missing
+}
+
+var Terminals = []Terminal{
+	{Name: Default, Title: "Apple Terminal", App: "Terminal.app", BundleID: "com.apple.Terminal", Builtin: true},
+	{Name: ITerm, Title: "iTerm", App: "iTerm.app", BundleID: "com.googlecode.iterm2"},
+	{Name: Warp, Title: "Warp", App: "Warp.app", BundleID: "dev.warp.Warp-Stable"},
+	{Name: Wave, Title: "Wave", App: "Wave.app", BundleID: "dev.commandline.waveterm"},
+	{Name: "Alacritty", Title: "Alacritty", App: "Alacritty.app", BundleID: "org.alacritty"},
+	{Name: "Kitty", Title: "Kitty", App: "kitty.app", BundleID: "net.kovidgoyal.kitty"},
+	{Name: "WezTerm", Title: "WezTerm", App: "WezTerm.app", BundleID: "com.github.wez.wezterm"},
+	{Name: "Ghostty", Title: "Ghostty", App: "Ghostty.app", BundleID: "com.mitchellh.ghostty"},
+	{Name: "Hyper", Title: "Hyper", App: "Hyper.app", BundleID: "co.zeit.hyper"},
+}
+
+// TerminalOptions are the valid values of the terminal param.
+func TerminalOptions() []string {
+	var options []string
+
+	for _, t := range Terminals {
+		options = append(options, t.Name)
+	}
+
+	return append(options, None)
+}
+
+func TerminalByName(name string) (Terminal, bool) {
+	for _, t := range Terminals {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+
+	return Terminal{}, false
+}
+
+// RuleFile is the name of the rule file installed for the terminal, e.g. iterm.json.
+func (t Terminal) RuleFile() string {
+	return ToSimpleParamName(t.Title) + ".json"
+}
+
+// TerminalParam is the terminal param of the params file: the name of a registered terminal, or a custom terminal object.
+type TerminalParam struct {
+	Name   string
+	Custom *CustomTerminal
+}
+
+func (t *TerminalParam) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&t.Name)
+	}
+
+	t.Custom = &CustomTerminal{}
+	return node.Decode(t.Custom)
+}
+
+// CustomTerminal is a terminal app that is not registered, like an in-house build.
+type CustomTerminal struct {
+	App      string         `yaml:"app" json:"app"`
+	BundleID string         `yaml:"bundle-id" json:"bundle-id"`
+	Args     []string       `yaml:"args" json:"args,omitempty"`
+	Extra    map[string]any `yaml:",inline" json:"-"`
+}
+
+func (c CustomTerminal) Terminal() Terminal {
+	name := strings.TrimSuffix(c.App, ".app")
+	return Terminal{Name: name, Title: name, App: name + ".app", BundleID: c.BundleID, Args: c.Args}
+}
+
+func ValidateTerminal(terminal *TerminalParam) error {
+	if terminal == nil {
+		return nil
+	}
+
+	if terminal.Custom == nil {
+		return ValidateParamValues("terminal", &[]string{terminal.Name}, TerminalOptions())
+	}
+
+	for field := range terminal.Custom.Extra {
+		return errors.New("Unknown parameter: terminal." + field)
+	}
+
+	if strings.TrimSpace(terminal.Custom.App) == "" || strings.TrimSpace(terminal.Custom.BundleID) == "" {
+		return errors.New("Invalid param 'terminal': app and bundle-id are required")
+	}
+
+	if _, found := TerminalByName(terminal.Custom.Terminal().Name); found || strings.EqualFold(terminal.Custom.Terminal().Name, None) {
+		return fmt.Errorf("Invalid param 'terminal': app '%s' clashes with a registered terminal, use its name instead", terminal.Custom.App)
+	}
+
+	return nil
+}
+
+// terminalParam returns the terminal selected in the params file, or else in the survey.
+func terminalParam(selected string, fileParam *TerminalParam) (string, *CustomTerminal) {
+	switch {
+	case fileParam == nil:
+		return selected, nil
+	case fileParam.Custom != nil:
+		return fileParam.Custom.Terminal().Name, fileParam.Custom
+	default:
+		return fileParam.Name, nil
+	}
+}
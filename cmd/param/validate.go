@@ -2,6 +2,7 @@ package param
 
 import (
 	"errors"
+	"regexp"
 	"strings"
 )
 
@@ -45,3 +46,17 @@ func ValidateAll(params ...func() error) error {
 	}
 	return nil
 }
+
+func ValidateBundleIdPatterns(param string, patterns *[]string) error {
+	if patterns == nil {
+		return nil
+	}
+
+	for _, p := range *patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return errors.New("Invalid param '" + param + "' bundle ID pattern '" + p + "': " + err.Error())
+		}
+	}
+
+	return nil
+}
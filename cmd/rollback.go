@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/task"
+	"strings"
+)
+
+type executedTask struct {
+	task.Task
+	installation install.Installation
+	journal      *install.JournalFileSystem
+}
+
+type RollbackError struct {
+	Err        error
+	RolledBack []string
+	NotRolled  []string
+}
+
+func (e *RollbackError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Err.Error())
+
+	if len(e.RolledBack) > 0 {
+		sb.WriteString("\n\nRolled back:")
+
+		for _, name := range e.RolledBack {
+			sb.WriteString("\n • " + name)
+		}
+	}
+
+	if len(e.NotRolled) > 0 {
+		sb.WriteString("\n\nCould not be rolled back:")
+
+		for _, name := range e.NotRolled {
+			sb.WriteString("\n • " + name)
+		}
+	}
+
+	return sb.String()
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// rollback undoes the executed tasks, including the failed one, in reverse order.
+func rollback(done []executedTask, cause error) error {
+	result := &RollbackError{Err: cause}
+
+	for idx := len(done) - 1; idx >= 0; idx-- {
+		t := done[idx]
+
+		if !t.journal.Changed() && t.Undo == nil {
+			continue
+		}
+
+		t.installation.TryLog(install.WarnMsg, "Roll back: "+t.Name)
+
+		err := t.journal.Revert()
+
+		if err == nil && t.Undo != nil {
+			err = t.Undo(t.installation)
+		}
+
+		if err != nil {
+			result.NotRolled = append(result.NotRolled, fmt.Sprintf("%s: %s", t.Name, err))
+		} else {
+			result.RolledBack = append(result.RolledBack, t.Name)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,257 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type CheckStatus string
+
+const (
+	Pass CheckStatus = "PASS"
+	Warn CheckStatus = "WARN"
+	Fail CheckStatus = "FAIL"
+)
+
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+	Fix     string
+}
+
+// Check inspects a part of an existing installation without changing anything.
+type Check struct {
+	Name string
+	Run  func(i install.Installation) []CheckResult
+}
+
+func Checks() []Check {
+	return []Check{
+		CheckDependencies(),
+		CheckKarabinerProfile(),
+		CheckLaunchAgent(),
+		CheckHidutilMapping(),
+		CheckIdeKeymaps(),
+	}
+}
+
+func CheckDependencies() Check {
+	return Check{
+		Name: "Dependencies",
+		Run: func(i install.Installation) []CheckResult {
+			var results []CheckResult
+
+			for _, d := range []Dependency{KarabinerDependency(), AltTabDependency(), RectangleDependency()} {
+				if common.Exists(d.command) {
+					results = append(results, CheckResult{d.name, Pass, "installed", ""})
+				} else {
+					results = append(results, CheckResult{d.name, Fail, "not installed", "Run: " + d.installCommand})
+				}
+			}
+
+			return results
+		},
+	}
+}
+
+func CheckKarabinerProfile() Check {
+	return Check{
+		Name: "Karabiner profile",
+		Run: func(i install.Installation) []CheckResult {
+			name := "Karabiner profile"
+			reinstall := "Run: " + common.BinaryName + " install"
+
+			if !i.FileExists(i.KarabinerConfigFile()) {
+				return []CheckResult{{name, Fail, loggedPath(i.KarabinerConfigFile(), i) + " not found", reinstall}}
+			}
+
+			data, err := i.ReadFile(i.KarabinerConfigFile())
+
+			if err != nil {
+				return []CheckResult{{name, Fail, err.Error(), reinstall}}
+			}
+
+			config, err := karabiner.ParseConfig(data)
+
+			if err != nil {
+				return []CheckResult{{name, Fail, "invalid Karabiner config: " + err.Error(), reinstall}}
+			}
+
+			profile := config.Profile(i.ProfileName())
+
+			if profile == nil {
+				return []CheckResult{{name, Fail, fmt.Sprintf("profile \"%s\" not found", i.ProfileName()), reinstall}}
+			}
+
+			selected := profile.Selected != nil && *profile.Selected
+
+			if !selected && !i.ProfileSelected() {
+				return []CheckResult{{name, Pass, fmt.Sprintf("profile \"%s\" exists, not selected as configured", i.ProfileName()), ""}}
+			}
+
+			if !selected {
+				return []CheckResult{{name, Warn, fmt.Sprintf("profile \"%s\" is not selected", i.ProfileName()),
+					fmt.Sprintf("Select profile \"%s\" in Karabiner-Elements settings", i.ProfileName())}}
+			}
+
+			return []CheckResult{{name, Pass, fmt.Sprintf("profile \"%s\" exists and is selected", i.ProfileName()), ""}}
+		},
+	}
+}
+
+func CheckLaunchAgent() Check {
+	return Check{
+		Name: "LaunchAgent",
+		Run: func(i install.Installation) []CheckResult {
+			launchAgent := filepath.Join(i.LaunchAgents(), "com.github.pcfy-my-mac.plist")
+			return []CheckResult{checkInstalledFile("LaunchAgent", "system/com.github.pcfy-my-mac.plist", launchAgent, i)}
+		},
+	}
+}
+
+func CheckHidutilMapping() Check {
+	return Check{
+		Name: "hidutil mapping",
+		Run: func(i install.Installation) []CheckResult {
+			name := "hidutil mapping"
+			fix := "Run: " + hidutilCommand()
+
+			active, err := activeKeyMappings()
+
+			if err != nil {
+				return []CheckResult{{name, Fail, "could not read the active mapping: " + err.Error(), fix}}
+			}
+
+			if !mappingsActive(active) {
+				return []CheckResult{{name, Fail, "modifier key mapping is not active", fix}}
+			}
+
+			return []CheckResult{{name, Pass, "modifier key mapping is active", ""}}
+		},
+	}
+}
+
+func CheckIdeKeymaps() Check {
+	return Check{
+		Name: "IDE keymaps",
+		Run: func(i install.Installation) []CheckResult {
+			var results []CheckResult
+			var expected []string
+
+			if i.FileExists(i.StateFile()) {
+				state, err := install.LoadState(i, i.StateFile())
+
+				if err == nil {
+					expected = state.Params.Keymaps
+				}
+			}
+
+			for _, ide := range param.IDEKeymaps {
+				installed := false
+
+				for _, path := range i.IdeKeymapPaths(ide) {
+					if i.FileExists(path) {
+						installed = true
+						results = append(results, checkInstalledFile(ide.FullName+" keymap", i.SourceKeymap(ide), path, i))
+					}
+				}
+
+				if !installed && slices.Contains(expected, ide.FullName) {
+					results = append(results, CheckResult{ide.FullName + " keymap", Fail, "keymap not found", "Restart " + ide.FullName + " and run: " + common.BinaryName + " install"})
+				}
+			}
+
+			if len(results) == 0 {
+				return []CheckResult{{"IDE keymaps", Warn, "no installed keymaps found", "Run: " + common.BinaryName + " install, and select keymaps to install"}}
+			}
+
+			return results
+		},
+	}
+}
+
+func checkInstalledFile(name, src, dst string, i install.Installation) CheckResult {
+	reinstall := "Run: " + common.BinaryName + " install"
+
+	if !i.FileExists(dst) {
+		return CheckResult{name, Fail, loggedPath(dst, i) + " not found", reinstall}
+	}
+
+	installed, err := i.ReadFile(dst)
+
+	if err != nil {
+		return CheckResult{name, Fail, err.Error(), reinstall}
+	}
+
+	embedded, _ := common.ReadFileFromEmbedFS(src)
+
+	if !bytes.Equal(installed, []byte(embedded)) {
+		return CheckResult{name, Warn, loggedPath(dst, i) + " differs from the bundled version", reinstall}
+	}
+
+	return CheckResult{name, Pass, loggedPath(dst, i) + " is up to date", ""}
+}
+
+func activeKeyMappings() (map[int64]int64, error) {
+	output, err := common.ExecCommand("hidutil", "property", "--get", "UserKeyMapping").Output()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKeyMappings(string(output)), nil
+}
+
+func mappingsActive(active map[int64]int64) bool {
+	for src, dst := range parseKeyMappings(hidutilCommand()) {
+		if active[src] != dst {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hidutilMappingActive() bool {
+	active, err := activeKeyMappings()
+	return err == nil && mappingsActive(active)
+}
+
+var keyMappingPattern = regexp.MustCompile(`HIDKeyboardModifierMapping(Src|Dst)"?\s*[:=]\s*(0x[0-9A-Fa-f]+|\d+)`)
+
+// parseKeyMappings reads source to destination key pairs from both the JSON passed to
+// "hidutil property --set" and the property list printed by "hidutil property --get".
+func parseKeyMappings(text string) map[int64]int64 {
+	mappings := map[int64]int64{}
+
+	for _, entry := range strings.Split(text, "}") {
+		keys := map[string]int64{}
+
+		for _, match := range keyMappingPattern.FindAllStringSubmatch(entry, -1) {
+			key, err := strconv.ParseInt(match[2], 0, 64)
+
+			if err == nil {
+				keys[match[1]] = key
+			}
+		}
+
+		src, hasSrc := keys["Src"]
+		dst, hasDst := keys["Dst"]
+
+		if hasSrc && hasDst {
+			mappings[src] = dst
+		}
+	}
+
+	return mappings
+}
@@ -0,0 +1,172 @@
+package task
+
+import (
+	"fmt"
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"slices"
+	"strings"
+)
+
+// userRule is a Karabiner rule PCfy rules may overlap: a custom rule, or a rule of another profile.
+type userRule struct {
+	karabiner.Rule
+	profile string
+	preset  bool // a rule of the preset
+	dropped bool // a custom rule left out in favour of the PCfy rule it overlaps
+}
+
+func (r userRule) String() string {
+	if r.preset {
+		return fmt.Sprintf("preset rule \"%s\"", r.Description)
+	}
+
+	if r.profile == "" {
+		return fmt.Sprintf("custom rule \"%s\"", r.Description)
+	}
+
+	return fmt.Sprintf("rule \"%s\" of profile \"%s\"", r.Description, r.profile)
+}
+
+// userRules lists the custom rules, the rules of the preset and the rules of the profiles other than the installed one.
+// Rules with the description of a bundled rule are left out, as they come from other PCfy profiles.
+func userRules(config *karabiner.Config, profileName string, custom, preset []karabiner.Rule) []userRule {
+	var rules []userRule
+
+	for _, r := range custom {
+		rules = append(rules, userRule{Rule: r})
+	}
+
+	for _, r := range preset {
+		rules = append(rules, userRule{Rule: r, preset: true})
+	}
+
+	for _, p := range config.Profiles {
+		if p.Name == profileName || p.ComplexModifications == nil {
+			continue
+		}
+
+		for _, r := range p.ComplexModifications.Rules {
+			bundled := slices.ContainsFunc(param.KarabinerRules, func(k param.KarabinerRule) bool { return k.Description == r.Description })
+
+			if !bundled {
+				rules = append(rules, userRule{Rule: r, profile: p.Name})
+			}
+		}
+	}
+
+	return rules
+}
+
+// AskConflictResolution asks how to resolve a conflict when the rule-conflicts parameter is set to ask.
+var AskConflictResolution = func(conflict string) string {
+	resolution := param.InstallBoth
+
+	common.HandleInterrupt(survey.AskOne(&survey.Select{
+		Message: conflict + ". Resolve with:",
+		Options: []string{param.InstallBoth, param.KeepUser, param.KeepPcfy},
+		Default: param.InstallBoth,
+		Description: func(value string, index int) string {
+			return conflictResolutionDescriptions[value]
+		},
+	}, &resolution))
+
+	return resolution
+}
+
+var conflictResolutionDescriptions = map[string]string{
+	param.InstallBoth: "the custom rule comes first",
+	param.KeepUser:    "leave the PCfy rule out",
+	param.KeepPcfy:    "leave the custom rule out",
+}
+
+// resolveConflicts reports the rules overlapping user rules and resolves every conflict as the rule-conflicts
+// parameter says: installs both rules, leaves the PCfy rule out, or installs the PCfy rule and leaves the overlapping
+// custom rule out. Rules of other profiles are never changed. Custom rules left out are marked as dropped in userRules.
+// When the parameter is set to ask, every conflict is asked for.
+func resolveConflicts(rules []karabiner.Rule, userRules []userRule, resolution string, update *karabinerUpdate) []karabiner.Rule {
+	var resolved []karabiner.Rule
+
+	for _, r := range rules {
+		kept := true
+
+		for idx := range userRules {
+			other := &userRules[idx]
+			overlap := r.Overlaps(other.Rule)
+
+			if other.dropped || overlap == nil {
+				continue
+			}
+
+			conflict := fmt.Sprintf("Rule \"%s\" overlaps %s on %s", r.Description, other, overlap)
+			chosen := conflictResolution(conflict, resolution, update)
+
+			update.warnings = append(update.warnings, fmt.Sprintf("%s. Resolving with %s (set rule-conflicts to %s)",
+				conflict, param.ToSimpleParamName(chosen), strings.Join(conflictResolutionParams(), ", ")))
+
+			switch param.ToSimpleParamName(chosen) {
+			case param.ToSimpleParamName(param.KeepUser):
+				update.change("skip rule \"%s\" overlapping %s", r.Description, other)
+				kept = false
+			case param.ToSimpleParamName(param.KeepPcfy):
+				if other.profile == "" {
+					other.dropped = true
+					update.change("skip %s overlapping rule \"%s\"", other, r.Description)
+				}
+			}
+
+			if !kept {
+				break
+			}
+		}
+
+		if kept {
+			resolved = append(resolved, r)
+		}
+	}
+
+	return resolved
+}
+
+// conflictResolution is the resolution of the rule-conflicts parameter, or the one answered for the conflict if it is
+// set to ask. Runs that may not ask install both rules.
+func conflictResolution(conflict, resolution string, update *karabinerUpdate) string {
+	if param.ToSimpleParamName(resolution) != param.ToSimpleParamName(param.Ask) {
+		return resolution
+	}
+
+	if update.resolutions == nil {
+		return param.InstallBoth
+	}
+
+	if _, asked := update.resolutions[conflict]; !asked {
+		update.resolutions[conflict] = AskConflictResolution(conflict)
+	}
+
+	return update.resolutions[conflict]
+}
+
+// keptCustomRules are the custom rules, or the rules of the preset, not dropped by resolveConflicts.
+func keptCustomRules(userRules []userRule, preset bool) []karabiner.Rule {
+	var rules []karabiner.Rule
+
+	for _, u := range userRules {
+		if u.profile == "" && u.preset == preset && !u.dropped {
+			rules = append(rules, u.Rule)
+		}
+	}
+
+	return rules
+}
+
+func conflictResolutionParams() []string {
+	var params []string
+
+	for _, o := range param.RuleConflictOptions {
+		params = append(params, param.ToSimpleParamName(o))
+	}
+
+	return params
+}
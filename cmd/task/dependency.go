@@ -14,14 +14,6 @@ func KarabinerDependency() Dependency {
 	}
 }
 
-func JqDependency() Dependency {
-	return Dependency{
-		name:           "jq",
-		command:        "jq",
-		installCommand: "brew install jq",
-	}
-}
-
 func AltTabDependency() Dependency {
 	return Dependency{
 		name:           "AltTab",
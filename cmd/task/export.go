@@ -0,0 +1,19 @@
+package task
+
+import (
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+)
+
+// ExportRules builds the rules the parameters install as a complex_modifications rule set, which can be imported in
+// Karabiner-Elements by hand instead of letting the installer edit karabiner.json. It returns the warnings of the build too.
+func ExportRules(i install.Installation) (karabiner.RuleSet, []string, error) {
+	update := &karabinerUpdate{config: &karabiner.Config{}}
+	profile, err := karabinerProfile(i, update)
+
+	if err != nil {
+		return karabiner.RuleSet{}, nil, err
+	}
+
+	return karabiner.RuleSet{Title: i.ProfileName(), Rules: profile.ComplexModifications.Rules}, update.warnings, nil
+}
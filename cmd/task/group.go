@@ -0,0 +1,85 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	GroupDependencies = "dependencies"
+	GroupKarabiner    = "karabiner"
+	GroupKeymaps      = "keymaps"
+	GroupRectangle    = "rectangle"
+	GroupAltTab       = "alttab"
+	GroupSystem       = "system"
+	GroupHidutil      = "hidutil"
+)
+
+var Groups = []string{GroupDependencies, GroupKarabiner, GroupKeymaps, GroupRectangle, GroupAltTab, GroupSystem, GroupHidutil}
+
+// Select returns the tasks of the given groups, together with the tasks they require, in their original order.
+// Tasks without a group always run. An empty only list selects all groups.
+func Select(tasks []Task, only, skip []string) ([]Task, error) {
+	for _, g := range append(slices.Clone(only), skip...) {
+		if !slices.Contains(Groups, g) {
+			return nil, errors.New("Unknown task group: " + g)
+		}
+	}
+
+	byName := map[string]Task{}
+
+	for _, t := range tasks {
+		byName[t.Name] = t
+	}
+
+	selected := map[string]bool{}
+
+	var include func(t Task, requiredBy string) error
+
+	include = func(t Task, requiredBy string) error {
+		if selected[t.Name] {
+			return nil
+		}
+
+		if requiredBy != "" && slices.Contains(skip, t.Group) {
+			return fmt.Errorf("Task \"%s\" requires \"%s\" from skipped group %s", requiredBy, t.Name, t.Group)
+		}
+
+		selected[t.Name] = true
+
+		for _, name := range t.Requires {
+			required, found := byName[name]
+
+			if !found {
+				return fmt.Errorf("Task \"%s\" requires unknown task \"%s\"", t.Name, name)
+			}
+
+			if err := include(required, t.Name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, t := range tasks {
+		if t.Group != "" && (slices.Contains(skip, t.Group) || (len(only) > 0 && !slices.Contains(only, t.Group))) {
+			continue
+		}
+
+		if err := include(t, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []Task
+
+	for _, t := range tasks {
+		if selected[t.Name] {
+			result = append(result, t)
+		}
+	}
+
+	return result, nil
+}
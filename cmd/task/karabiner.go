@@ -0,0 +1,752 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// karabinerUpdate is the Karabiner config an installation should end up with. It is built in memory
+// from the current config, so the file is only written, and Karabiner only restarted, when it changes.
+type karabinerUpdate struct {
+	config   *karabiner.Config
+	changes  []string
+	warnings []string
+
+	// resolutions are the answers to the rule conflicts asked, so each conflict is asked once per installation.
+	// It is nil when nothing may be asked, as in dry runs and exports, where asked conflicts install both rules.
+	resolutions map[string]string
+}
+
+func (u *karabinerUpdate) change(format string, a ...any) {
+	u.changes = append(u.changes, fmt.Sprintf(format, a...))
+}
+
+func InstallKarabinerRuleFiles() Task {
+	return Task{
+		Name:  "Install Karabiner rule files",
+		Group: GroupKarabiner,
+		Execute: func(i install.Installation) error {
+			files, _, err := karabinerRuleFiles(i)
+
+			if err != nil {
+				return err
+			}
+
+			for _, file := range files {
+				src, data := karabinerRuleFile(i, file)
+				err := writeAsset(src, filepath.Join(i.KarabinerComplexModificationsDir(), file), []byte(data), i)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func UpdateKarabinerConfig() Task {
+	resolutions := map[string]string{}
+
+	return Task{
+		Name:     "Update Karabiner config",
+		Group:    GroupKarabiner,
+		Requires: []string{ValidateKarabinerRules().Name, DownloadDependencies().Name, InstallKarabinerRuleFiles().Name},
+		UpToDate: func(i install.Installation) (bool, error) {
+			update, err := installedKarabinerConfig(i, resolutions)
+
+			if err != nil {
+				return false, err
+			}
+
+			return karabinerConfigUpToDate(i, update.config)
+		},
+		Execute: func(i install.Installation) error {
+			update, err := installedKarabinerConfig(i, resolutions)
+
+			if err != nil {
+				return err
+			}
+
+			for _, w := range update.warnings {
+				i.TryLog(install.WarnMsg, w)
+			}
+
+			if err := closeApp(i, "Karabiner-Menu"); err != nil {
+				return err
+			}
+
+			if err := backupKarabinerConfig(i); err != nil {
+				return err
+			}
+
+			if err := writeKarabinerConfig(i, update); err != nil {
+				return err
+			}
+
+			return openApp(i, "Karabiner-Elements")
+		},
+		Undo: func(i install.Installation) error {
+			return openApp(i, "Karabiner-Elements")
+		},
+	}
+}
+
+func InstallAppLauncherPreferences() Task {
+	var applied []SystemSetting
+
+	return Task{
+		Name:     "Install app launcher preferences",
+		Group:    GroupKarabiner,
+		Requires: []string{UpdateKarabinerConfig().Name},
+		Execute: func(i install.Installation) error {
+			launcher, found := param.AppLauncherByName(i.AppLauncher)
+
+			if !found || len(launcher.PreferenceFiles) == 0 && len(launcher.Defaults) == 0 {
+				return nil
+			}
+
+			if !launcher.Installed() {
+				return skip(i, launcher.Name+" app not found")
+			}
+
+			for _, f := range launcher.PreferenceFiles {
+				path, found := preferenceFilePath(i, f)
+
+				if !found {
+					continue
+				}
+
+				if _, err := installPreferenceFile(i, f, path); err != nil {
+					return err
+				}
+			}
+
+			if setting, found := appLauncherSetting(launcher); found {
+				changed, err := applySystemSetting(i, setting)
+
+				if err != nil {
+					return err
+				}
+
+				applied = append(applied, setting)
+
+				if changed {
+					return openApp(i, shellQuote(setting.restart))
+				}
+			}
+
+			return nil
+		},
+		Undo: func(i install.Installation) error {
+			return revertSystemSettings(i, applied, i.State)
+		},
+	}
+}
+
+// preferenceFilePath is where a launcher preference file goes. Alfred keeps a local/{hash} directory for each Mac
+// syncing its preferences, the one of the Mac it runs on being the local hash of its prefs.json.
+func preferenceFilePath(i install.Installation, f param.PreferenceFile) (string, bool) {
+	prefs := alfredPreferences(i)
+	dir := strings.ReplaceAll(f.Dir, "{alfred-preferences}", prefs.dir)
+
+	if strings.Contains(dir, "{alfred-local-hash}") {
+		if prefs.localHash == "" {
+			return "", false
+		}
+
+		dir = strings.ReplaceAll(dir, "{alfred-local-hash}", prefs.localHash)
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(i.Path, dir)
+	}
+
+	return filepath.Join(dir, filepath.Base(f.Asset)), true
+}
+
+type alfredPrefs struct {
+	dir       string
+	localHash string
+}
+
+// alfredPreferences reads Alfred's prefs.json: the Alfred.alfredpreferences folder Alfred reads, which is in the sync
+// folder when one is set in Alfred's Advanced preferences, and the hash of the Mac it runs on in that folder.
+func alfredPreferences(i install.Installation) alfredPrefs {
+	prefs := alfredPrefs{dir: filepath.Join(i.ApplicationSupportDir(), "Alfred/Alfred.alfredpreferences")}
+	prefsFile := filepath.Join(i.ApplicationSupportDir(), "Alfred/prefs.json")
+
+	if !i.FileExists(prefsFile) {
+		return prefs
+	}
+
+	data, err := i.ReadFile(prefsFile)
+
+	if err != nil {
+		return prefs
+	}
+
+	var file struct {
+		Current   string `json:"current"`
+		LocalHash string `json:"localhash"`
+	}
+
+	if json.Unmarshal(data, &file) != nil {
+		return prefs
+	}
+
+	prefs.localHash = file.LocalHash
+
+	if rest, found := strings.CutPrefix(file.Current, "~/"); found {
+		prefs.dir = filepath.Join(i.Path, rest)
+	} else if file.Current != "" {
+		prefs.dir = file.Current
+	}
+
+	return prefs
+}
+
+// installPreferenceFile copies a launcher preference file, or merges its entry only into the existing file, so that
+// the other preferences in it are kept. It tells if the file changed.
+func installPreferenceFile(i install.Installation, f param.PreferenceFile, path string) (bool, error) {
+	data, _ := common.ReadFileFromEmbedFS(f.Asset)
+
+	if f.Entry == "" || !i.FileExists(path) {
+		changed := !fileContains(i, path, []byte(data))
+		return changed, writeAsset(f.Asset, path, []byte(data), i)
+	}
+
+	value, found := plistEntry(data, f.Entry)
+
+	if !found {
+		return false, errors.New("No entry " + f.Entry + " in " + f.Asset)
+	}
+
+	current, err := i.ReadFile(path)
+
+	if err != nil {
+		return false, err
+	}
+
+	if installed, found := plistEntry(string(current), f.Entry); found && installed == value {
+		return false, nil
+	}
+
+	_, err = i.Run(fmt.Sprintf("plutil -replace %s -xml %s %s", f.Entry, shellQuote(value), shellQuote(path)))
+	return true, err
+}
+
+// installedKarabinerConfig replaces the installed profile in the current config with a new one built from the parameters.
+func installedKarabinerConfig(i install.Installation, resolutions map[string]string) (*karabinerUpdate, error) {
+	config, err := currentKarabinerConfig(i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	update := &karabinerUpdate{config: config, resolutions: resolutions}
+	existing := config.Profile(i.ProfileName())
+
+	if i.DryRun {
+		update.resolutions = nil
+	}
+
+	if existing != nil {
+		update.change("replace profile \"%s\"", i.ProfileName())
+	} else {
+		update.change("add profile \"%s\"", i.ProfileName())
+	}
+
+	profile, err := karabinerProfile(i, update)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !i.ProfileSelected() {
+		profile.Selected = new(bool)
+
+		if existing != nil && existing.Selected != nil {
+			*profile.Selected = *existing.Selected
+		}
+	}
+
+	if existing != nil {
+		*existing = profile
+	} else {
+		config.AddProfile(profile)
+	}
+
+	if i.ProfileSelected() {
+		config.UnselectOtherProfiles(i.ProfileName())
+		update.change("unselect profiles other than \"%s\"", i.ProfileName())
+	}
+
+	return update, nil
+}
+
+// karabinerProfile builds the profile the parameters install, recording its changes and warnings in the update.
+// Rules of the other profiles of the updated config are checked for conflicts.
+func karabinerProfile(i install.Installation, update *karabinerUpdate) (karabiner.Profile, error) {
+	profileJson, _ := common.ReadFileFromEmbedFS("karabiner/karabiner-profile.json")
+	profile, err := karabiner.ParseProfile([]byte(profileJson))
+
+	if err != nil {
+		return karabiner.Profile{}, err
+	}
+
+	profile.Name = i.ProfileName()
+	files, warnings, err := karabinerRuleFiles(i)
+
+	if err != nil {
+		return karabiner.Profile{}, err
+	}
+
+	update.warnings = warnings
+
+	if i.KarabinerParameters != nil {
+		count := setKarabinerParameters(&profile, *i.KarabinerParameters)
+		update.change("set %d Karabiner parameters in profile \"%s\"", count, i.ProfileName())
+	}
+
+	if i.FunctionKeys != "" {
+		count := mapFunctionKeys(&profile, i.FunctionKeys, i.CustomFunctionKeys)
+		update.change("map %d function keys for %s function keys in profile \"%s\"", count, strings.ToLower(i.FunctionKeys), i.ProfileName())
+	}
+
+	others := userRules(update.config, i.ProfileName(), customRules(i.CustomRules), presetRules(i))
+	var fileRules [][]karabiner.Rule
+
+	for _, file := range files {
+		_, rulesJson := karabinerRuleFile(i, file)
+		ruleSet, err := karabiner.ParseRuleSet([]byte(rulesJson))
+
+		if err != nil {
+			return karabiner.Profile{}, err
+		}
+
+		fileRules = append(fileRules, resolveConflicts(withoutExcludedRules(file, ruleSet.Rules, i.ExcludedRules), others, i.RuleConflictResolution(), update))
+	}
+
+	custom := keptCustomRules(others, false)
+
+	if len(custom) > 0 {
+		profile.AddRules(custom...)
+		update.change("add %d custom rules in profile \"%s\"", len(custom), i.ProfileName())
+	}
+
+	if preset := keptCustomRules(others, true); len(preset) > 0 {
+		profile.AddRules(preset...)
+		update.change("add %d preset rules in profile \"%s\"", len(preset), i.ProfileName())
+	}
+
+	for f, file := range files {
+		rules := fileRules[f]
+
+		if terminal, found := i.SelectedTerminal(); found && file == "main.json" && terminal.BundleID != "" {
+			excluded := 0
+
+			for r := range rules {
+				if rules[r].ExcludeAppsAlongside(`^com\.apple\.Terminal$`, appCondition("", []string{terminal.BundleID}).BundleIdentifiers) {
+					excluded++
+				}
+			}
+
+			if excluded > 0 {
+				update.change("exclude %s from %d rules of main.json in profile \"%s\"", terminal.Name, excluded, i.ProfileName())
+			}
+		}
+
+		excludeApps := file == "main.json" && len(i.ExcludedApps) > 0
+
+		if excludeApps {
+			for r := range rules {
+				rules[r].ExcludeApps(i.ExcludedApps)
+			}
+		}
+
+		profile.AddRules(rules...)
+		update.change("add %d rules from %s in profile \"%s\"", len(rules), file, i.ProfileName())
+
+		if excludeApps {
+			update.change("exclude %d apps from the rules of main.json in profile \"%s\"", len(i.ExcludedApps), i.ProfileName())
+		}
+	}
+
+	pcKeyboards, macKeyboards := keyboardIdentifiers(i.Keyboards)
+
+	switch strings.ToLower(i.KeyboardLayout) {
+	case strings.ToLower(param.PC):
+		if len(macKeyboards) > 0 {
+			builtIn := true
+			keyboards := append([]karabiner.DeviceIdentifiers{{IsBuiltInKeyboard: &builtIn, Description: "MacBook built-in keyboard"}}, macKeyboards...)
+			profile.ReplaceBuiltInKeyboardConditions(&karabiner.Condition{Type: "device_if", Identifiers: keyboards})
+			update.change("add %d Mac layout keyboards to built-in keyboard conditions in profile \"%s\"", len(macKeyboards), i.ProfileName())
+		}
+	case strings.ToLower(param.Mac), strings.ToLower(param.None):
+		if len(pcKeyboards) > 0 {
+			profile.ReplaceBuiltInKeyboardConditions(&karabiner.Condition{Type: "device_unless", Identifiers: pcKeyboards})
+			update.change("replace built-in keyboard conditions with %d PC layout keyboard exclusions in profile \"%s\"", len(pcKeyboards), i.ProfileName())
+		} else {
+			profile.RemoveBuiltInKeyboardConditions()
+			update.change("remove built-in keyboard conditions in profile \"%s\"", i.ProfileName())
+		}
+	default:
+		return karabiner.Profile{}, errors.New("Unknown keyboard layout: " + i.KeyboardLayout)
+	}
+
+	return profile, nil
+}
+
+// keyboardIdentifiers splits the keyboards of the keyboards parameter by layout. The rules that depend on the
+// layout, like the Opt/Cmd swap, are the ones with built-in keyboard conditions.
+func keyboardIdentifiers(keyboards []param.Keyboard) ([]karabiner.DeviceIdentifiers, []karabiner.DeviceIdentifiers) {
+	var pc, mac []karabiner.DeviceIdentifiers
+
+	for _, k := range keyboards {
+		id := karabiner.DeviceIdentifiers{VendorID: k.VendorID, ProductID: k.ProductID, Description: k.Description}
+
+		if strings.EqualFold(k.Layout, param.Mac) {
+			mac = append(mac, id)
+		} else {
+			pc = append(pc, id)
+		}
+	}
+
+	return pc, mac
+}
+
+// setKarabinerParameters writes the karabiner-parameters set into the profile and returns how many there are.
+func setKarabinerParameters(profile *karabiner.Profile, p param.KarabinerParameters) int {
+	if profile.ComplexModifications == nil {
+		profile.ComplexModifications = &karabiner.ComplexModifications{}
+	}
+
+	if profile.ComplexModifications.Parameters == nil {
+		profile.ComplexModifications.Parameters = map[string]int{}
+	}
+
+	parameters := p.ComplexModifications()
+
+	for key, value := range parameters {
+		profile.ComplexModifications.Parameters[key] = value
+	}
+
+	count := len(parameters)
+
+	if profile.VirtualHIDKeyboard == nil {
+		profile.VirtualHIDKeyboard = &karabiner.VirtualHIDKeyboard{}
+	}
+
+	keyboard := profile.VirtualHIDKeyboard
+
+	if p.KeyboardType != nil {
+		keyboard.KeyboardTypeV2 = strings.ToLower(*p.KeyboardType)
+		count++
+	}
+
+	if p.CountryCode != nil {
+		keyboard.CountryCode = p.CountryCode
+		count++
+	}
+
+	if p.MouseKeyXYScale != nil {
+		keyboard.MouseKeyXYScale = p.MouseKeyXYScale
+		count++
+	}
+
+	if p.StickyModifiersState != nil {
+		keyboard.IndicateStickyModifierKeysState = p.StickyModifiersState
+		count++
+	}
+
+	return count
+}
+
+// mapFunctionKeys sets what every F-key sends in fn_function_keys, which Karabiner applies to the F-keys pressed
+// with Fn in standard mode, the fnState system setting making them standard function keys, and without Fn in media
+// and custom modes. They send the media actions of the profile asset, except the F-keys of the custom-function-keys
+// parameter in custom mode.
+func mapFunctionKeys(profile *karabiner.Profile, mode string, custom map[string]string) int {
+	var keys []karabiner.FnFunctionKey
+
+	for _, f := range param.FunctionKeys {
+		to := []karabiner.Event{{KeyCode: f}}
+
+		if n := slices.IndexFunc(profile.FnFunctionKeys, func(k karabiner.FnFunctionKey) bool { return k.From != nil && k.From.KeyCode == f }); n != -1 {
+			to = profile.FnFunctionKeys[n].To
+		}
+
+		for from, key := range custom {
+			if event, found := karabiner.KeyEvent(key); found && strings.EqualFold(from, f) && strings.EqualFold(mode, param.Custom) {
+				to = []karabiner.Event{event}
+			}
+		}
+
+		keys = append(keys, karabiner.FnFunctionKey{From: &karabiner.From{KeyCode: f}, To: to})
+	}
+
+	profile.FnFunctionKeys = keys
+	return len(keys)
+}
+
+// presetRules are the rules of the selected preset, if any.
+func presetRules(i install.Installation) []karabiner.Rule {
+	if preset, found := i.SelectedPreset(); found {
+		return customRules(preset.Rules(i.AppLauncher))
+	}
+
+	return nil
+}
+
+func customRules(rules []param.CustomRule) []karabiner.Rule {
+	var result []karabiner.Rule
+
+	for _, r := range rules {
+		to, _ := karabiner.KeyEvent(r.To.KeyCode)
+		to.Modifiers = r.To.Modifiers
+		manipulator := karabiner.Manipulator{
+			Type: "basic",
+			From: &karabiner.From{KeyCode: r.From.KeyCode},
+			To:   []karabiner.Event{to},
+		}
+
+		if len(r.From.Modifiers) > 0 {
+			manipulator.From.Modifiers = &karabiner.Modifiers{Mandatory: r.From.Modifiers}
+		}
+
+		if len(r.Apps) > 0 {
+			manipulator.Conditions = append(manipulator.Conditions, appCondition("frontmost_application_if", r.Apps))
+		}
+
+		if len(r.ExcludedApps) > 0 {
+			manipulator.Conditions = append(manipulator.Conditions, appCondition("frontmost_application_unless", r.ExcludedApps))
+		}
+
+		result = append(result, karabiner.Rule{
+			Description:  r.Name(),
+			Manipulators: []karabiner.Manipulator{manipulator},
+		})
+	}
+
+	return result
+}
+
+// withoutExcludedRules leaves out the rules of a bundled rule file excluded with the karabiner-rules parameter.
+func withoutExcludedRules(file string, rules []karabiner.Rule, excluded []string) []karabiner.Rule {
+	return slices.DeleteFunc(rules, func(r karabiner.Rule) bool {
+		return slices.ContainsFunc(param.KarabinerRules, func(k param.KarabinerRule) bool {
+			return k.File == file && k.Description == r.Description && slices.Contains(excluded, k.ID)
+		})
+	})
+}
+
+func appCondition(conditionType string, bundleIds []string) karabiner.Condition {
+	var patterns []string
+
+	for _, id := range bundleIds {
+		patterns = append(patterns, "^"+regexp.QuoteMeta(id)+"$")
+	}
+
+	return karabiner.Condition{Type: conditionType, BundleIdentifiers: patterns}
+}
+
+// karabinerRuleFiles lists the rule files from the karabiner assets selected by the parameters, in the order they are applied.
+func karabinerRuleFiles(i install.Installation) ([]string, []string, error) {
+	var files []string
+	var warnings []string
+
+	if terminal, found := i.SelectedTerminal(); found {
+		if terminal.Builtin || common.Exists(terminal.App) {
+			files = append(files, terminal.RuleFile())
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s app not found. Skipping...", strings.TrimSuffix(terminal.App, ".app")))
+		}
+	} else if !strings.EqualFold(i.Terminal, param.None) {
+		return nil, nil, errors.New("Unknown terminal: " + i.Terminal)
+	}
+
+	files = append(files, "main.json", "finder.json")
+
+	launcher, found := param.AppLauncherByName(i.AppLauncher)
+
+	if !found {
+		return nil, nil, errors.New("Unknown app launcher: " + i.AppLauncher)
+	}
+
+	if launcher.Installed() {
+		files = append(files, launcher.RuleFile())
+	} else {
+		warnings = append(warnings, launcher.Name+" app not found. Skipping...")
+	}
+
+	return files, warnings, nil
+}
+
+// karabinerRuleFile returns the source and the content of a rule file listed by karabinerRuleFiles. The terminal and
+// app launcher rule files are generated from the karabiner/terminal.json and karabiner/app-launcher.json templates,
+// the others are karabiner assets.
+func karabinerRuleFile(i install.Installation, file string) (string, string) {
+	if t, found := i.SelectedTerminal(); found && t.RuleFile() == file {
+		return "karabiner/terminal.json", terminalRuleFile(t)
+	}
+
+	if l, found := param.AppLauncherByName(i.AppLauncher); found && l.RuleFile() == file {
+		return "karabiner/app-launcher.json", appLauncherRuleFile(l)
+	}
+
+	src := filepath.Join("karabiner", file)
+	data, _ := common.ReadFileFromEmbedFS(src)
+	return src, data
+}
+
+// terminalRuleFile fills the karabiner/terminal.json template in with the terminal.
+func terminalRuleFile(t param.Terminal) string {
+	template, _ := common.ReadFileFromEmbedFS("karabiner/terminal.json")
+	return strings.NewReplacer("{title}", jsonString(t.Title), "{command}", jsonString(terminalCommand(t))).Replace(template)
+}
+
+// appLauncherRuleFile fills the karabiner/app-launcher.json template in with the launcher, sending its key where
+// the template has the {key} placeholder.
+func appLauncherRuleFile(l param.AppLauncher) string {
+	template, _ := common.ReadFileFromEmbedFS("karabiner/app-launcher.json")
+	ruleSet, _ := karabiner.ParseRuleSet([]byte(strings.NewReplacer("{title}", jsonString(l.Title), "{win}", jsonString(l.WinDescription())).Replace(template)))
+
+	for r := range ruleSet.Rules {
+		for m := range ruleSet.Rules[r].Manipulators {
+			manipulator := &ruleSet.Rules[r].Manipulators[m]
+
+			if slices.ContainsFunc(manipulator.ToIfAlone, func(e karabiner.Event) bool { return e.ShellCommand == "{key}" }) {
+				manipulator.ToIfAlone = l.Key
+			}
+		}
+	}
+
+	data, _ := ruleSet.Bytes()
+	return string(data)
+}
+
+// terminalCommand is the shell command opening the terminal, with its launch arguments if any.
+func terminalCommand(t param.Terminal) string {
+	command := "open -a " + shellQuote(strings.TrimSuffix(t.App, ".app"))
+
+	if len(t.Args) > 0 {
+		var args []string
+
+		for _, a := range t.Args {
+			args = append(args, shellQuote(a))
+		}
+
+		command += " --args " + strings.Join(args, " ")
+	}
+
+	return command
+}
+
+var safeShellWord = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote quotes a word for the shell unless it is made of safe characters only.
+func shellQuote(word string) string {
+	if safeShellWord.MatchString(word) {
+		return word
+	}
+
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// jsonString escapes text to be put between the quotes of a JSON string.
+func jsonString(text string) string {
+	data, _ := json.Marshal(text)
+	return string(data[1 : len(data)-1])
+}
+
+// currentKarabinerConfig reads the Karabiner config, or the default one if Karabiner has not created it yet.
+func currentKarabinerConfig(i install.Installation) (*karabiner.Config, error) {
+	data, err := currentKarabinerConfigBytes(i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return karabiner.ParseConfig(data)
+}
+
+func currentKarabinerConfigBytes(i install.Installation) ([]byte, error) {
+	if !i.FileExists(i.KarabinerConfigFile()) {
+		data, err := common.ReadFileFromEmbedFS(filepath.Join("karabiner", "default.json"))
+		return []byte(data), err
+	}
+
+	return i.ReadFile(i.KarabinerConfigFile())
+}
+
+// karabinerConfigUpToDate compares the configs in the format they are saved in, so formatting
+// differences of the existing file do not count as a change.
+func karabinerConfigUpToDate(i install.Installation, config *karabiner.Config) (bool, error) {
+	if !i.FileExists(i.KarabinerConfigFile()) {
+		return false, nil
+	}
+
+	current, err := currentKarabinerConfig(i)
+
+	if err != nil {
+		return false, err
+	}
+
+	currentData, err := current.Bytes()
+
+	if err != nil {
+		return false, err
+	}
+
+	data, err := config.Bytes()
+
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(currentData, data), nil
+}
+
+func backupKarabinerConfig(i install.Installation) error {
+	data, err := currentKarabinerConfigBytes(i)
+
+	if err != nil {
+		return err
+	}
+
+	src := i.KarabinerConfigFile()
+
+	if !i.FileExists(src) {
+		src = filepath.Join("karabiner", "default.json")
+	}
+
+	backup := i.KarabinerConfigBackupFile(i.InstallationTime)
+	i.TryLog(install.FileMsg, fmt.Sprintf("Copy file %s to %s", loggedPath(src, i), loggedPath(backup, i)))
+	return i.WriteFile(backup, data)
+}
+
+func writeKarabinerConfig(i install.Installation, update *karabinerUpdate) error {
+	data, err := update.config.Bytes()
+
+	if err != nil {
+		return err
+	}
+
+	for _, c := range update.changes {
+		i.TryLog(install.FileMsg, fmt.Sprintf("Update file %s: %s", loggedPath(i.KarabinerConfigFile(), i), c))
+	}
+
+	return i.WriteFile(i.KarabinerConfigFile(), data)
+}
@@ -0,0 +1,88 @@
+package task
+
+import (
+	"regexp"
+	"strings"
+)
+
+var plistWhitespace = regexp.MustCompile(`>\s+<`)
+
+// plistValue finds the XML of the value of a key in an XML plist, returning its start and end offsets.
+func plistValue(plist, key string) (int, int, bool) {
+	keyStart := strings.Index(plist, "<key>"+key+"</key>")
+
+	if keyStart == -1 {
+		return 0, 0, false
+	}
+
+	start := keyStart + len("<key>"+key+"</key>")
+	start += len(plist[start:]) - len(strings.TrimLeft(plist[start:], " \t\n"))
+	rest := plist[start:]
+
+	switch {
+	case strings.HasPrefix(rest, "<dict>"):
+		depth := 0
+
+		for pos := 0; pos < len(rest); pos++ {
+			switch {
+			case strings.HasPrefix(rest[pos:], "<dict>"):
+				depth++
+			case strings.HasPrefix(rest[pos:], "</dict>"):
+				depth--
+
+				if depth == 0 {
+					return start, start + pos + len("</dict>"), true
+				}
+			}
+		}
+
+		return 0, 0, false
+	case strings.HasPrefix(rest, "<"):
+		end := strings.Index(rest, ">")
+
+		if end == -1 {
+			return 0, 0, false
+		}
+
+		if rest[end-1] != '/' {
+			closing := strings.Index(rest, "</")
+
+			if closing == -1 {
+				return 0, 0, false
+			}
+
+			end = strings.Index(rest[closing:], ">")
+
+			if end == -1 {
+				return 0, 0, false
+			}
+
+			end += closing
+		}
+
+		return start, start + end + 1, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// plistEntry returns the XML of the dict a key of an XML plist holds, on a single line.
+func plistEntry(plist, key string) (string, bool) {
+	start, end, found := plistValue(plist, key)
+
+	if !found || !strings.HasPrefix(plist[start:], "<dict>") {
+		return "", false
+	}
+
+	return plistWhitespace.ReplaceAllString(plist[start:end], "><"), true
+}
+
+// plistWithEntry sets a key of the top level dict of an XML plist to the value XML, adding the key if missing.
+func plistWithEntry(plist, key, value string) string {
+	if start, end, found := plistValue(plist, key); found {
+		return plist[:start] + value + plist[end:]
+	}
+
+	end := strings.LastIndex(plist, "</dict>")
+	return plist[:end] + "<key>" + key + "</key>" + value + plist[end:]
+}
@@ -0,0 +1,118 @@
+package task
+
+import (
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"strings"
+)
+
+type DefaultsKey struct {
+	domain    string
+	key       string
+	valueType string
+	value     string
+}
+
+func (k DefaultsKey) writeCommand() string {
+	return fmt.Sprintf("defaults write %s %s -%s %s", k.domain, k.key, k.valueType, k.value)
+}
+
+// matches compares the value with one printed by "defaults read", which shows booleans as 1 and 0.
+func (k DefaultsKey) matches(current string) bool {
+	if k.valueType == "bool" {
+		return current == map[string]string{"true": "1", "false": "0"}[k.value]
+	}
+
+	return current == k.value
+}
+
+func (k DefaultsKey) deleteCommand() string {
+	return fmt.Sprintf("defaults delete %s %s 2>/dev/null || true", k.domain, k.key)
+}
+
+func (k DefaultsKey) restoreCommand(previous *string) string {
+	if previous == nil {
+		return k.deleteCommand()
+	}
+
+	return fmt.Sprintf("defaults write %s %s -%s '%s'", k.domain, k.key, k.valueType, strings.ReplaceAll(*previous, "'", `'\''`))
+}
+
+type SystemSetting struct {
+	name     string
+	defaults []DefaultsKey
+	asset    string // copied to the same path relative to ~/Library
+	restart  string
+}
+
+var systemSettings = []SystemSetting{
+	{
+		name: "Enable Dock auto-hide (2s delay)",
+		defaults: []DefaultsKey{
+			{"com.apple.dock", "autohide", "bool", "true"},
+			{"com.apple.dock", "autohide-delay", "float", "2"},
+		},
+		restart: "Dock",
+	},
+	{
+		name:     `Change Dock minimize animation to "scale"`,
+		defaults: []DefaultsKey{{"com.apple.dock", "mineffect", "string", "scale"}},
+		restart:  "Dock",
+	},
+	{
+		name:  "Enable Home and End keys",
+		asset: "KeyBindings/DefaultKeyBinding.dict",
+	},
+	{
+		name:     "Show hidden files in Finder",
+		defaults: []DefaultsKey{{"com.apple.finder", "AppleShowAllFiles", "bool", "true"}},
+	},
+	{
+		name:     "Show directories on top in Finder",
+		defaults: []DefaultsKey{{"com.apple.finder", "_FXSortFoldersFirst", "bool", "true"}},
+	},
+	{
+		name:     "Show full POSIX paths in Finder window title",
+		defaults: []DefaultsKey{{"com.apple.finder", "_FXShowPosixPathInTitle", "bool", "true"}},
+	},
+}
+
+// functionKeysSetting sets what the F-keys send without Fn, as the function-keys parameter says. Media and custom
+// function keys keep the macOS default, media keys, with F-keys mapped in fn_function_keys of the Karabiner profile.
+func functionKeysSetting(mode string) (SystemSetting, bool) {
+	if mode == "" {
+		return SystemSetting{}, false
+	}
+
+	standard := strings.EqualFold(mode, param.Standard)
+
+	return SystemSetting{
+		name:     "Function keys",
+		defaults: []DefaultsKey{{"-g", "com.apple.keyboard.fnState", "bool", fmt.Sprint(standard)}},
+	}, true
+}
+
+func systemSettingByName(name string) (SystemSetting, bool) {
+	for _, s := range systemSettings {
+		if param.ToSimpleParamName(s.name) == param.ToSimpleParamName(name) {
+			return s, true
+		}
+	}
+
+	return SystemSetting{}, false
+}
+
+// appLauncherSetting sets the hotkey of a launcher configured with defaults, closing it so that it is reopened with it.
+func appLauncherSetting(l param.AppLauncher) (SystemSetting, bool) {
+	if len(l.Defaults) == 0 {
+		return SystemSetting{}, false
+	}
+
+	var keys []DefaultsKey
+
+	for _, d := range l.Defaults {
+		keys = append(keys, DefaultsKey{d.Domain, d.Key, d.Type, d.Value})
+	}
+
+	return SystemSetting{name: l.Name + " hotkey", defaults: keys, restart: l.Name}, true
+}
@@ -0,0 +1,144 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"slices"
+	"strings"
+)
+
+func SaveInstallationState() Task {
+	return Task{
+		Name: "Save installation state",
+		Execute: func(i install.Installation) error {
+			state := i.State
+
+			for _, path := range state.WrittenFiles() {
+				if !i.FileExists(path) || path == i.StateFile() {
+					continue
+				}
+
+				data, err := i.ReadFile(path)
+
+				if err != nil {
+					return err
+				}
+
+				state.AddFile(path, data)
+			}
+
+			earlier := mergeEarlierState(i, state)
+
+			slices.SortFunc(state.Files, func(a, b install.FileState) int { return strings.Compare(a.Path, b.Path) })
+
+			if earlier != nil && sameInstallation(state, earlier) {
+				state.InstalledAt = earlier.InstalledAt
+			}
+
+			data, err := state.Bytes()
+
+			if err != nil {
+				return err
+			}
+
+			if fileContains(i, i.StateFile(), data) {
+				return nil
+			}
+
+			i.TryLog(install.FileMsg, fmt.Sprintf("Write file %s", loggedPath(i.StateFile(), i)))
+			return i.WriteFile(i.StateFile(), data)
+		},
+	}
+}
+
+// mergeEarlierState carries over what an earlier installation recorded: the previous defaults values,
+// so re-running the installer does not record its own values as the ones to restore, the files
+// and settings of task groups that were not part of this run, and the profiles installed under other names.
+func mergeEarlierState(i install.Installation, state *install.State) *install.State {
+	if !i.FileExists(i.StateFile()) {
+		return nil
+	}
+
+	earlier, err := install.LoadState(i, i.StateFile())
+
+	if err != nil {
+		i.TryLog(install.WarnMsg, fmt.Sprintf("Cannot read %s: %s", loggedPath(i.StateFile(), i), err))
+		return nil
+	}
+
+	for idx, d := range state.Defaults {
+		if recorded, found := earlier.FindDefaults(d.Domain, d.Key); found {
+			state.Defaults[idx].Previous = recorded.Previous
+		}
+	}
+
+	for _, d := range earlier.Defaults {
+		if _, found := state.FindDefaults(d.Domain, d.Key); !found {
+			state.Defaults = append(state.Defaults, d)
+		}
+	}
+
+	for _, f := range earlier.Files {
+		written := slices.ContainsFunc(state.Files, func(written install.FileState) bool { return written.Path == f.Path })
+
+		if !written && i.FileExists(f.Path) {
+			state.Files = append(state.Files, f)
+		}
+	}
+
+	for _, p := range append(slices.Clone(earlier.Profiles), earlier.Params.ProfileName()) {
+		if !slices.Contains(state.Profiles, p) {
+			state.Profiles = append(state.Profiles, p)
+		}
+	}
+
+	slices.Sort(state.Profiles)
+
+	if state.LaunchAgent == "" {
+		state.LaunchAgent = earlier.LaunchAgent
+	}
+
+	return earlier
+}
+
+// sameInstallation reports whether the states differ only in their installation time.
+func sameInstallation(state, earlier *install.State) bool {
+	s := *state
+	s.InstalledAt = earlier.InstalledAt
+
+	data, err := s.Bytes()
+	earlierData, earlierErr := earlier.Bytes()
+
+	return err == nil && earlierErr == nil && bytes.Equal(data, earlierData)
+}
+
+// fileUpToDate reports whether path holds data, also when the file was converted after an earlier installation wrote it.
+func fileUpToDate(i install.Installation, path string, data []byte) bool {
+	if !i.FileExists(path) {
+		return false
+	}
+
+	current, err := i.ReadFile(path)
+
+	if err != nil {
+		return false
+	}
+
+	if bytes.Equal(current, data) {
+		return true
+	}
+
+	if !i.FileExists(i.StateFile()) {
+		return false
+	}
+
+	earlier, err := install.LoadState(i, i.StateFile())
+
+	if err != nil {
+		return false
+	}
+
+	file, found := earlier.FindFile(path)
+	return found && file.Source == install.Checksum(data) && file.Checksum == install.Checksum(current)
+}
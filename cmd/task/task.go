@@ -1,31 +1,78 @@
 package task
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/raxigan/pcfy-my-mac/cmd/common"
 	"github.com/raxigan/pcfy-my-mac/cmd/install"
 	"github.com/raxigan/pcfy-my-mac/cmd/param"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// Task is a single installation step. UpToDate reports whether the result of the step is already
+// in place, so Execute can be skipped. Undo reverts what Execute did apart from file changes,
+// which are reverted by the caller.
 type Task struct {
-	Name    string
-	Execute func(i install.Installation) error
+	Name     string
+	Group    string
+	Requires []string // names of the tasks that have to run before this one
+	UpToDate func(i install.Installation) (bool, error)
+	Execute  func(i install.Installation) error
+	Undo     func(i install.Installation) error
+}
+
+type Status string
+
+const (
+	Changed   Status = "changed"
+	Unchanged Status = "unchanged"
+	Skipped   Status = "skipped"
+)
+
+// ErrSkipped is returned by Execute when there is nothing the task can do, e.g. the app it configures is missing.
+var ErrSkipped = errors.New("skipped")
+
+func skip(i install.Installation, reason string) error {
+	i.TryLog(install.WarnMsg, reason+". Skipping...")
+	return ErrSkipped
+}
+
+// DependenciesDeclinedError is returned when the installation of the missing dependencies is declined.
+type DependenciesDeclinedError struct {
+	Dependencies []string
+}
+
+func (e *DependenciesDeclinedError) Error() string {
+	return "dependencies declined: " + strings.Join(e.Dependencies, ", ")
+}
+
+// ConfirmDependencies asks whether the missing dependencies may be installed. Dry runs do not ask.
+var ConfirmDependencies = func(dependencies []string) bool {
+	confirmed := false
+
+	common.HandleInterrupt(survey.AskOne(&survey.Confirm{
+		Message: fmt.Sprintf("The following dependencies will be installed: %s. Do you agree?", strings.Join(dependencies, ", ")),
+	}, &confirmed))
+
+	return confirmed
 }
 
 func DownloadDependencies() Task {
+	var installed []string
+
 	return Task{
-		Name: "Install dependencies",
+		Name:  "Install dependencies",
+		Group: GroupDependencies,
 		Execute: func(i install.Installation) error {
 
 			var notInstalled []string
 			var commands []string
 
-			all := []Dependency{JqDependency(), KarabinerDependency(), AltTabDependency(), RectangleDependency()}
+			all := []Dependency{KarabinerDependency(), AltTabDependency(), RectangleDependency()}
 
 			for _, d := range all {
 				if !common.Exists(d.command) {
@@ -35,383 +82,316 @@ func DownloadDependencies() Task {
 			}
 
 			if len(notInstalled) > 0 {
-				installApp := false
-				prompt := &survey.Confirm{
-					Message: fmt.Sprintf("The following dependencies will be installed: %s. Do you agree?", strings.Join(notInstalled, ", ")),
+				if !i.DryRun && !ConfirmDependencies(notInstalled) {
+					return &DependenciesDeclinedError{Dependencies: notInstalled}
 				}
-				common.HandleInterrupt(
-					survey.AskOne(prompt, &installApp),
-				)
 
-				if !installApp {
-					fmt.Printf("Qutting...")
-					i.Exit(0)
-				}
+				for idx, c := range commands {
+					if _, err := i.Run(c); err != nil {
+						return err
+					}
 
-				for _, c := range commands {
-					i.Run(c)
+					installed = append(installed, notInstalled[idx])
 				}
 			}
 
 			return nil
 
 		},
-	}
-}
+		Undo: func(i install.Installation) error {
+			if len(installed) > 0 {
+				return errors.New("installed dependencies are kept: " + strings.Join(installed, ", "))
+			}
 
-func CloseKarabiner() Task {
-	return Task{
-		Name:    "Close Karabiner",
-		Execute: func(i install.Installation) error { i.Run("killall Karabiner-Menu"); return nil },
+			return nil
+		},
 	}
 }
 
-func BackupKarabinerConfig() Task {
+func CopyIdeKeymaps() Task {
 	return Task{
-		Name: "Backup karabiner config",
+		Name:  "Install IDE keymaps",
+		Group: GroupKeymaps,
 		Execute: func(i install.Installation) error {
-			original := i.KarabinerConfigFile()
-			backupDest := i.KarabinerConfigBackupFile(i.InstallationTime)
-
-			configExists := common.FileExists(original)
-
-			if !configExists {
-				os.MkdirAll(i.KarabinerComplexModificationsDir(), 0755)
-				copyFile(filepath.Join("karabiner", "default.json"), original, i)
-			}
+			for _, keymap := range i.Keymaps {
+				name, err := param.IdeKeymapByFullName(keymap)
 
-			err := common.CopyFile(original, backupDest)
+				if err != nil {
+					return err
+				}
 
-			if err != nil {
-				return err
+				if err := InstallIdeKeymap(i, name); err != nil {
+					return err
+				}
 			}
-
 			return nil
 		},
 	}
 }
 
-func DeleteExistingKarabinerProfile() Task {
+func CloseRectangle() Task {
 	return Task{
-		Name: "Delete existing Karabiner profile",
-		Execute: func(i install.Installation) error {
-			deleteProfileJqCmd := fmt.Sprintf("jq --arg PROFILE_NAME \"%s\" 'del(.profiles[] | select(.name == \"%s\"))' %s >tmp && mv tmp %s", i.ProfileName, i.ProfileName, i.KarabinerConfigFile(), i.KarabinerConfigFile())
-			i.Run(deleteProfileJqCmd)
-			return nil
+		Name:  "Close rectangle",
+		Group: GroupRectangle,
+		UpToDate: func(i install.Installation) (bool, error) {
+			return !common.IsRunning("Rectangle") || rectanglePreferencesUpToDate(i), nil
 		},
-	}
-}
-
-func CreateKarabinerProfile() Task {
-	return Task{
-		Name: "Create new Karabiner profile",
 		Execute: func(i install.Installation) error {
-			copyFile("karabiner/karabiner-profile.json", "tmp", i)
-			addProfileJqCmd := fmt.Sprintf("jq '.profiles += $profile' %s --slurpfile profile tmp --indent 4 >INPUT.tmp && mv INPUT.tmp %s && rm tmp", i.KarabinerConfigFile(), i.KarabinerConfigFile())
-			i.Run(addProfileJqCmd)
-			return nil
+			return closeApp(i, "Rectangle")
 		},
-	}
-}
-
-func NameKarabinerProfile() Task {
-	return Task{
-		Name: "Rename new Karabiner profile",
-		Execute: func(i install.Installation) error {
-			copyFile("karabiner/karabiner-profile.json", "tmp", i)
-			addProfileJqCmd := fmt.Sprintf("jq '.profiles |= map(if .name == \"_PROFILE_NAME_\" then .name = \"%s\" else . end)' %s > tmp && mv tmp %s", i.ProfileName, i.KarabinerConfigFile(), i.KarabinerConfigFile())
-			i.Run(addProfileJqCmd)
-			return nil
+		Undo: func(i install.Installation) error {
+			return openApp(i, "Rectangle")
 		},
 	}
 }
 
-func UnselectOtherKarabinerProfiles() Task {
+func CopyRectanglePreferences() Task {
 	return Task{
-		Name: "Unselect other Karabiner profiles",
-		Execute: func(i install.Installation) error {
-			unselectJqCmd := fmt.Sprintf("jq '.profiles |= map(if .name != \"%s\" then .selected = false else . end)' %s > tmp && mv tmp %s", i.ProfileName, i.KarabinerConfigFile(), i.KarabinerConfigFile())
-			i.Run(unselectJqCmd)
-			return nil
+		Name:     "Install Rectangle preferences",
+		Group:    GroupRectangle,
+		Requires: []string{CloseRectangle().Name},
+		UpToDate: func(i install.Installation) (bool, error) {
+			return rectanglePreferencesUpToDate(i), nil
 		},
-	}
-}
-
-func ApplyMainKarabinerRules() Task {
-	return Task{
-		Name: "Apply main Karabiner rules",
 		Execute: func(i install.Installation) error {
-			ApplyRules(i, "main.json")
-			ApplyRules(i, "finder.json")
-			return nil
-		},
-	}
-}
+			rectanglePlist := rectanglePreferencesFile(i)
+			err := writeAsset("rectangle/com.knollsoft.Rectangle.plist", rectanglePlist, rectanglePreferences(i), i)
 
-func ApplyAppLauncherRules() Task {
-	return Task{
-		Name: "Apply app launcher rules",
-		Execute: func(i install.Installation) error {
-			switch strings.ToLower(i.AppLauncher) {
-			case strings.ToLower(param.None):
-				ApplyRules(i, "app-launcher-none.json")
-			case strings.ToLower(param.Spotlight):
-				ApplyRules(i, "spotlight.json")
-			case strings.ToLower(param.Launchpad):
-				ApplyRules(i, "launchpad.json")
-			case strings.ToLower(param.Alfred):
-				{
-					if common.Exists("Alfred 4.app") || common.Exists("Alfred 5.app") {
-
-						ApplyRules(i, "alfred.json")
-
-						paths, err := common.FindMatchingPaths(i.ApplicationSupportDir()+"/Alfred/Alfred.alfredpreferences/preferences/local/{version}/hotkey", "prefs.plist")
-
-						if err != nil {
-							return err
-						}
-
-						for _, path := range paths {
-							copyFile("alfred/prefs.plist", path, i)
-						}
-					} else {
-						i.TryLog(install.WarnMsg, "Alfred app not found. Skipping...")
-					}
-				}
-			default:
-				return errors.New("Unknown app launcher: " + i.AppLauncher)
+			if err != nil {
+				return err
 			}
 
-			return nil
+			plutilCmdRectangle := fmt.Sprintf("plutil -convert binary1 %s", rectanglePlist)
+
+			if _, err := i.Run(plutilCmdRectangle); err != nil {
+				return err
+			}
+
+			_, err = i.Run("defaults read com.knollsoft.Rectangle.plist")
+			return err
 		},
 	}
 }
 
-func ApplyKeyboardLayoutRules() Task {
+func OpenRectangle() Task {
 	return Task{
-		Name: "Apply keyboard layout rules",
+		Name:     "Open Rectangle.app",
+		Group:    GroupRectangle,
+		Requires: []string{DownloadDependencies().Name, CopyRectanglePreferences().Name},
+		UpToDate: func(i install.Installation) (bool, error) {
+			return common.IsRunning("Rectangle"), nil
+		},
 		Execute: func(i install.Installation) error {
-			switch strings.ToLower(i.KeyboardLayout) {
-			case strings.ToLower(param.PC):
-			case strings.ToLower(param.Mac), strings.ToLower(param.None):
-				jq := fmt.Sprintf("jq --arg PROFILE_NAME \"%s\" '.profiles |= map(if .name == \"%s\" then walk(if type == \"object\" and .conditions then del(.conditions[] | select(.identifiers[]?.is_built_in_keyboard)) else . end) else . end)' %s --indent 4 >tmp && mv tmp %s", i.ProfileName, i.ProfileName, i.KarabinerConfigFile(), i.KarabinerConfigFile())
-				i.Run(jq)
-			default:
-				return errors.New("Unknown keyboard layout: " + i.KeyboardLayout)
-			}
-			return nil
+			return openApp(i, "Rectangle")
+		},
+		Undo: func(i install.Installation) error {
+			return closeApp(i, "Rectangle")
 		},
 	}
 }
 
-func ApplyTerminalRules() Task {
-	return Task{
-		Name: "Apply terminal rules",
-		Execute: func(i install.Installation) error {
+func rectanglePreferencesFile(i install.Installation) string {
+	return filepath.Join(i.PreferencesDir(), "com.knollsoft.Rectangle.plist")
+}
 
-			switch strings.ToLower(i.Terminal) {
-			case strings.ToLower(param.None):
-			case strings.ToLower(param.Default):
-				ApplyRules(i, "apple-terminal.json")
-			case strings.ToLower(param.ITerm):
-				if common.Exists("iTerm.app") {
-					ApplyRules(i, "iterm.json")
-				} else {
-					common.PrintColored(common.Yellow, fmt.Sprintf("iTerm app not found. Skipping..."))
-				}
-			case strings.ToLower(param.Warp):
-				{
-					if common.Exists("Warp.app") {
-						ApplyRules(i, "warp.json")
-					} else {
-						common.PrintColored(common.Yellow, fmt.Sprintf("Warp app not found. Skipping..."))
-					}
-				}
-			case strings.ToLower(param.Wave):
-				{
-					if common.Exists("Wave.app") {
-						ApplyRules(i, "wave.json")
-					} else {
-						common.PrintColored(common.Yellow, fmt.Sprintf("Wave app not found. Skipping..."))
-					}
-				}
-			default:
-				return errors.New("Unknown terminal: " + i.Terminal)
-			}
+// rectanglePreferences are the Rectangle preferences asset, with the window shortcuts of the preset if any.
+func rectanglePreferences(i install.Installation) []byte {
+	data, _ := common.ReadFileFromEmbedFS("rectangle/com.knollsoft.Rectangle.plist")
 
-			return nil
-		},
+	if preset, found := i.SelectedPreset(); found {
+		for _, action := range sortedKeys(preset.WindowShortcuts) {
+			shortcut := preset.WindowShortcuts[action]
+			data = plistWithEntry(data, action, fmt.Sprintf("<dict><key>keyCode</key><integer>%d</integer><key>modifierFlags</key><integer>%d</integer></dict>", shortcut.KeyCode, shortcut.Modifiers))
+		}
 	}
+
+	return []byte(data)
 }
 
-func ReformatKarabinerConfigFile() Task {
-	return Task{
-		Name: "Reformat Karabiner config file",
-		Execute: func(i install.Installation) error {
-			i.Run(fmt.Sprintf("jq '.' %s > tmp && mv tmp %s", i.KarabinerConfigFile(), i.KarabinerConfigFile()))
-			return nil
-		},
-	}
+func rectanglePreferencesUpToDate(i install.Installation) bool {
+	return fileUpToDate(i, rectanglePreferencesFile(i), rectanglePreferences(i))
 }
 
-func OpenKarabiner() Task {
+func CloseAltTab() Task {
 	return Task{
-		Name: "Open Karabiner-Elements.app",
+		Name:  "Close AtlTab.app",
+		Group: GroupAltTab,
+		UpToDate: func(i install.Installation) (bool, error) {
+			return !common.IsRunning("AltTab") || altTabPreferencesUpToDate(i), nil
+		},
 		Execute: func(i install.Installation) error {
-			i.Run("open -a Karabiner-Elements")
-			return nil
+			return closeApp(i, "AltTab")
+		},
+		Undo: func(i install.Installation) error {
+			return openApp(i, "AltTab")
 		},
 	}
 }
 
-func CopyIdeKeymaps() Task {
+func InstallAltTabPreferences() Task {
 	return Task{
-		Name: "Install IDE keymaps",
+		Name:     "Install AltTab preferences",
+		Group:    GroupAltTab,
+		Requires: []string{CloseAltTab().Name},
+		UpToDate: func(i install.Installation) (bool, error) {
+			return altTabPreferencesUpToDate(i), nil
+		},
 		Execute: func(i install.Installation) error {
-			for _, keymap := range i.Keymaps {
-				name, err := param.IdeKeymapByFullName(keymap)
 
-				if err != nil {
-					i.Commander.TryLog(install.StdErrMsg, err.Error())
-					i.Exit(1)
-				}
+			i.Commander.TryLog(install.FileMsg, fmt.Sprintf("Exclude %s from AltTab", i.Blacklist))
 
-				InstallIdeKeymap(i, name)
+			altTabPlist := altTabPreferencesFile(i)
+			err := writeAsset("alt-tab/com.lwouis.alt-tab-macos.plist", altTabPlist, altTabPreferences(i), i)
+
+			if err != nil {
+				return err
 			}
-			return nil
-		},
-	}
-}
 
-func CloseRectangle() Task {
-	return Task{
-		Name: "Close rectangle",
-		Execute: func(i install.Installation) error {
-			i.Run("killall Rectangle")
-			return nil
-		},
-	}
-}
+			plutilCmd := fmt.Sprintf("plutil -convert binary1 %s", altTabPlist)
 
-func CopyRectanglePreferences() Task {
-	return Task{
-		Name: "Install Rectangle preferences",
-		Execute: func(i install.Installation) error {
-			rectanglePlist := filepath.Join(i.PreferencesDir(), "com.knollsoft.Rectangle.plist")
-			copyFile("rectangle/com.knollsoft.Rectangle.plist", rectanglePlist, i)
+			if _, err := i.Run(plutilCmd); err != nil {
+				return err
+			}
 
-			plutilCmdRectangle := fmt.Sprintf("plutil -convert binary1 %s", rectanglePlist)
-			i.Run(plutilCmdRectangle)
-			i.Run("defaults read com.knollsoft.Rectangle.plist")
-			return nil
+			_, err = i.Run("defaults read com.lwouis.alt-tab-macos.plist")
+			return err
 		},
 	}
 }
 
-func OpenRectangle() Task {
+func OpenAltTab() Task {
 	return Task{
-		Name: "Open Rectangle.app",
-		Execute: func(i install.Installation) error {
-			i.Run("open -a Rectangle")
-			return nil
+		Name:     "Open AtlTab.app",
+		Group:    GroupAltTab,
+		Requires: []string{DownloadDependencies().Name, InstallAltTabPreferences().Name},
+		UpToDate: func(i install.Installation) (bool, error) {
+			return common.IsRunning("AltTab"), nil
 		},
-	}
-}
-
-func CloseAltTab() Task {
-	return Task{
-		Name: "Close AtlTab.app",
 		Execute: func(i install.Installation) error {
-			i.Run("killall AltTab")
-			return nil
+			return openApp(i, "AltTab")
+		},
+		Undo: func(i install.Installation) error {
+			return closeApp(i, "AltTab")
 		},
 	}
 }
 
-func InstallAltTabPreferences() Task {
-	return Task{
-		Name: "Install AltTab preferences",
-		Execute: func(i install.Installation) error {
+func altTabPreferencesFile(i install.Installation) string {
+	return filepath.Join(i.PreferencesDir(), "com.lwouis.alt-tab-macos.plist")
+}
 
-			i.Commander.TryLog(install.TaskMsg, fmt.Sprintf("Exclude %s from AltTab", i.Blacklist))
+func altTabBlacklist(i install.Installation) string {
+	var mappedStrings []string
+	for _, bundle := range i.Blacklist {
+		mappedStrings = append(mappedStrings, fmt.Sprintf(`{"ignore":"0","bundleIdentifier":"%s","hide":"1"}`, bundle))
+	}
 
-			altTabPlist := filepath.Join(i.PreferencesDir(), "com.lwouis.alt-tab-macos.plist")
-			copyFile("alt-tab/com.lwouis.alt-tab-macos.plist", altTabPlist, i)
+	return "[" + strings.Join(mappedStrings, ",") + "]"
+}
 
-			var mappedStrings []string
-			for _, bundle := range i.Blacklist {
-				mappedStrings = append(mappedStrings, fmt.Sprintf(`{"ignore":"0","bundleIdentifier":"%s","hide":"1"}`, bundle))
-			}
+// altTabPreferences are the AltTab preferences asset with the blacklist, and the settings of the preset if any.
+func altTabPreferences(i install.Installation) []byte {
+	data, _ := common.ReadFileFromEmbedFS("alt-tab/com.lwouis.alt-tab-macos.plist")
+	data = strings.ReplaceAll(data, "_BLACKLIST_", altTabBlacklist(i))
 
-			result := "[" + strings.Join(mappedStrings, ",") + "]"
+	if preset, found := i.SelectedPreset(); found {
+		for _, key := range sortedKeys(preset.AltTab) {
+			data = plistWithEntry(data, key, "<string>"+preset.AltTab[key]+"</string>")
+		}
+	}
 
-			common.ReplaceWordInFile(altTabPlist, "_BLACKLIST_", result)
+	return []byte(data)
+}
 
-			plutilCmd := fmt.Sprintf("plutil -convert binary1 %s", altTabPlist)
-			i.Run(plutilCmd)
+// sortedKeys lists the keys of a map in order, so that files built from it do not change between runs.
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
 
-			i.Run("defaults read com.lwouis.alt-tab-macos.plist")
-			return nil
-		},
+	for k := range m {
+		keys = append(keys, k)
 	}
+
+	sort.Strings(keys)
+	return keys
 }
 
-func OpenAltTab() Task {
-	return Task{
-		Name: "Open AtlTab.app",
-		Execute: func(i install.Installation) error {
-			i.Run("open -a AltTab")
-			return nil
-		},
-	}
+func altTabPreferencesUpToDate(i install.Installation) bool {
+	return fileUpToDate(i, altTabPreferencesFile(i), altTabPreferences(i))
 }
 
 func ApplySystemSettings() Task {
+	var applied []SystemSetting
+
 	return Task{
-		Name: "Apply system settings",
+		Name:  "Apply system settings",
+		Group: GroupSystem,
 		Execute: func(i install.Installation) error {
+			var settings []SystemSetting
+
 			for _, value := range i.SystemSettings {
-				simpleParamName := param.ToSimpleParamName(value)
+				if setting, found := systemSettingByName(value); found {
+					settings = append(settings, setting)
+				}
+			}
 
-				switch simpleParamName {
-				case "enable-dock-auto-hide-2s-delay":
-					{
-						i.Run("defaults write com.apple.dock autohide -bool true")
-						i.Run("defaults write com.apple.dock autohide-delay -float 2 && killall Dock")
-					}
-				case "change-dock-minimize-animation-to-scale":
-					{
-						i.Run(`defaults write com.apple.dock "mineffect" -string "scale" && killall Dock`)
-					}
-				case "enable-home-and-end-keys":
-					{
-						copyFile("system/DefaultKeyBinding.dict", filepath.Join(i.LibraryDir(), "/KeyBindings/DefaultKeyBinding.dict"), i)
-					}
-				case "show-hidden-files-in-finder":
-					{
-						i.Run("defaults write com.apple.finder AppleShowAllFiles -bool true")
-					}
-				case "show-directories-on-top-in-finder":
-					{
-						i.Run("defaults write com.apple.finder _FXSortFoldersFirst -bool true")
-					}
-				case "show-full-posix-paths-in-finder-window-title":
-					{
-						i.Run("defaults write com.apple.finder _FXShowPosixPathInTitle -bool true")
-					}
+			if setting, found := functionKeysSetting(i.FunctionKeys); found {
+				settings = append(settings, setting)
+			}
 
+			for _, setting := range settings {
+				if _, err := applySystemSetting(i, setting); err != nil {
+					return err
 				}
+
+				applied = append(applied, setting)
 			}
 
 			return nil
 		},
+		Undo: func(i install.Installation) error {
+			return revertSystemSettings(i, applied, i.State)
+		},
 	}
 }
 
-func ApplyRules(i install.Installation, file string) {
-	copyFile(filepath.Join("karabiner", file), filepath.Join(i.KarabinerComplexModificationsDir(), file), i)
-	jq := fmt.Sprintf("jq --arg PROFILE_NAME \"%s\" '(.profiles[] | select(.name == \"%s\") | .complex_modifications.rules) += $rules[].rules' %s --slurpfile rules %s/%s >tmp && mv tmp %s", i.ProfileName, i.ProfileName, i.KarabinerConfigFile(), i.KarabinerComplexModificationsDir(), file, i.KarabinerConfigFile())
-	i.Run(jq)
+// applySystemSetting writes the defaults keys of the setting that differ from the current values, restarting its app
+// if any did, and tells if any did.
+func applySystemSetting(i install.Installation, setting SystemSetting) (bool, error) {
+	changed := false
+
+	for _, key := range setting.defaults {
+		var previous *string
+
+		if value, found := common.ReadDefaults(key.domain, key.key); found {
+			previous = &value
+		}
+
+		i.State.AddDefaults(key.domain, key.key, key.value, previous)
+
+		if previous != nil && key.matches(*previous) {
+			continue
+		}
+
+		if _, err := i.Run(key.writeCommand()); err != nil {
+			return false, err
+		}
+
+		changed = true
+	}
+
+	if setting.asset != "" {
+		err := copyFile(filepath.Join("system", filepath.Base(setting.asset)), filepath.Join(i.LibraryDir(), setting.asset), i)
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if changed && setting.restart != "" {
+		return true, closeApp(i, setting.restart)
+	}
+
+	return changed, nil
 }
 
 func InstallIdeKeymap(i install.Installation, ide param.IDE) error {
@@ -436,43 +416,96 @@ func InstallIdeKeymap(i install.Installation, ide param.IDE) error {
 
 func CopyHidutilRemappingFile() Task {
 	return Task{
-		Name: "Copy hidutil remapping file",
+		Name:  "Copy hidutil remapping file",
+		Group: GroupHidutil,
 		Execute: func(i install.Installation) error {
-			copyFile("system/com.github.pcfy-my-mac.plist", filepath.Join(i.LaunchAgents(), "com.github.pcfy-my-mac.plist"), i)
-			return nil
+			launchAgent := filepath.Join(i.LaunchAgents(), "com.github.pcfy-my-mac.plist")
+			i.State.LaunchAgent = launchAgent
+			return copyFile("system/com.github.pcfy-my-mac.plist", launchAgent, i)
 		},
 	}
 }
 
 func ExecuteHidutil() Task {
 	return Task{
-		Name: "Execute hidutil command",
+		Name:     "Execute hidutil command",
+		Group:    GroupHidutil,
+		Requires: []string{CopyHidutilRemappingFile().Name},
+		UpToDate: func(i install.Installation) (bool, error) {
+			return hidutilMappingActive(), nil
+		},
 		Execute: func(i install.Installation) error {
-			remappingFile, _ := common.ReadFileFromEmbedFS("system/com.github.pcfy-my-mac.plist")
-			start := strings.Index(remappingFile, "<array>")
-			end := strings.Index(remappingFile, "</array>")
-			arrayContent := remappingFile[start+len("<array>") : end]
-
-			arrayContent = strings.ReplaceAll(arrayContent, "<string>{\"", "<string>'{\"")
-			arrayContent = strings.ReplaceAll(arrayContent, "]}</string>", "]}'</string>")
+			_, err := i.Run(hidutilCommand())
+			return err
+		},
+		Undo: func(i install.Installation) error {
+			_, err := i.Run(resetHidutilCommand)
+			return err
+		},
+	}
+}
 
-			arrayContent = strings.ReplaceAll(arrayContent, "<string>", "")
-			arrayContent = strings.ReplaceAll(arrayContent, "</string>", "")
+func openApp(i install.Installation, app string) error {
+	_, err := i.Run("open -a " + app)
+	return err
+}
 
-			command := strings.TrimSpace(arrayContent)
-			command = strings.Join(strings.Fields(command), " ")
-			command = strings.ReplaceAll(command, "/usr/bin/hidutil", "hidutil")
+// closeApp quits the given process. It is not an error when the process is not running.
+func closeApp(i install.Installation, process string) error {
+	_, err := i.Run("killall " + process)
 
-			i.Run(command)
+	var cmdErr *install.CommandError
 
-			return nil
-		},
+	if errors.As(err, &cmdErr) && cmdErr.Result.ExitCode == 1 {
+		return nil
 	}
+
+	return err
+}
+
+func hidutilCommand() string {
+	remappingFile, _ := common.ReadFileFromEmbedFS("system/com.github.pcfy-my-mac.plist")
+	start := strings.Index(remappingFile, "<array>")
+	end := strings.Index(remappingFile, "</array>")
+	arrayContent := remappingFile[start+len("<array>") : end]
+
+	arrayContent = strings.ReplaceAll(arrayContent, "<string>{\"", "<string>'{\"")
+	arrayContent = strings.ReplaceAll(arrayContent, "]}</string>", "]}'</string>")
+
+	arrayContent = strings.ReplaceAll(arrayContent, "<string>", "")
+	arrayContent = strings.ReplaceAll(arrayContent, "</string>", "")
+
+	command := strings.TrimSpace(arrayContent)
+	command = strings.Join(strings.Fields(command), " ")
+	command = strings.ReplaceAll(command, "/usr/bin/hidutil", "hidutil")
+
+	return command
 }
 
 func copyFile(src, dst string, i install.Installation) error {
-	loggedSrc := strings.ReplaceAll(src, i.HomeDir.Path, "~")
-	loggedDst := strings.ReplaceAll(dst, i.HomeDir.Path, "~")
-	i.TryLog(install.FileMsg, fmt.Sprintf("Copy file %s to %s", loggedSrc, loggedDst))
-	return common.CopyFileFromEmbedFS(src, dst)
+	data, _ := common.ReadFileFromEmbedFS(src)
+	return writeAsset(src, dst, []byte(data), i)
+}
+
+// writeAsset writes data, the content of the src asset, to dst unless dst already holds it.
+func writeAsset(src, dst string, data []byte, i install.Installation) error {
+	if fileContains(i, dst, data) {
+		return nil
+	}
+
+	i.TryLog(install.FileMsg, fmt.Sprintf("Copy file %s to %s", loggedPath(src, i), loggedPath(dst, i)))
+	return i.WriteFile(dst, data)
+}
+
+func fileContains(i install.Installation, path string, data []byte) bool {
+	if !i.FileExists(path) {
+		return false
+	}
+
+	current, err := i.ReadFile(path)
+	return err == nil && bytes.Equal(current, data)
+}
+
+func loggedPath(path string, i install.Installation) string {
+	return strings.ReplaceAll(path, i.HomeDir.Path, "~")
 }
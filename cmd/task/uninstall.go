@@ -0,0 +1,342 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"path/filepath"
+	"slices"
+)
+
+const resetHidutilCommand = `hidutil property --set '{"UserKeyMapping":[]}'`
+
+func RemoveKarabinerProfile() Task {
+	return Task{
+		Name: "Remove Karabiner profile",
+		UpToDate: func(i install.Installation) (bool, error) {
+			if !i.FileExists(i.KarabinerConfigFile()) {
+				return true, nil
+			}
+
+			update, err := uninstalledKarabinerConfig(i)
+
+			if err != nil {
+				return false, err
+			}
+
+			return karabinerConfigUpToDate(i, update.config)
+		},
+		Execute: func(i install.Installation) error {
+			update, err := uninstalledKarabinerConfig(i)
+
+			if err != nil {
+				return err
+			}
+
+			for _, w := range update.warnings {
+				i.TryLog(install.WarnMsg, w)
+			}
+
+			if err := closeApp(i, "Karabiner-Menu"); err != nil {
+				return err
+			}
+
+			if err := writeKarabinerConfig(i, update); err != nil {
+				return err
+			}
+
+			return openApp(i, "Karabiner-Elements")
+		},
+		Undo: func(i install.Installation) error {
+			return openApp(i, "Karabiner-Elements")
+		},
+	}
+}
+
+// uninstalledKarabinerConfig restores the Karabiner config backed up by the latest installation, leaving out the
+// installed profiles if the backup has them from earlier installations. Without a backup, it only deletes the installed
+// profiles, so other profiles are left alone.
+func uninstalledKarabinerConfig(i install.Installation) (*karabinerUpdate, error) {
+	backup, found := i.LatestKarabinerConfigBackupFile()
+
+	if !found {
+		return profileRemovedKarabinerConfig(i)
+	}
+
+	data, err := i.ReadFile(backup)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := karabiner.ParseConfig(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	update := &karabinerUpdate{config: config}
+	update.change("restore %s", loggedPath(backup, i))
+
+	for _, name := range installedProfiles(i) {
+		if config.Profile(name) != nil {
+			config.DeleteProfile(name)
+			update.change("delete profile \"%s\"", name)
+			config.SelectFirstProfileIfNoneSelected()
+		}
+	}
+
+	return update, nil
+}
+
+// profileRemovedKarabinerConfig deletes the installed profiles from the current config and nothing else.
+func profileRemovedKarabinerConfig(i install.Installation) (*karabinerUpdate, error) {
+	config, err := currentKarabinerConfig(i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	update := &karabinerUpdate{config: config}
+	selected := false
+
+	for _, name := range installedProfiles(i) {
+		profile := config.Profile(name)
+
+		if profile == nil {
+			continue
+		}
+
+		selected = selected || profile.Selected != nil && *profile.Selected
+		config.DeleteProfile(name)
+		update.change("delete profile \"%s\"", name)
+	}
+
+	if selected {
+		update.warnings = append(update.warnings, "No Karabiner config backup found. Selecting the first profile...")
+		config.SelectFirstProfileIfNoneSelected()
+	}
+
+	return update, nil
+}
+
+// installedProfiles are the profile of the parameters and the profiles the installation state records, which include
+// the ones installed with other profile-name values.
+func installedProfiles(i install.Installation) []string {
+	profiles := []string{i.ProfileName()}
+
+	if !i.FileExists(i.StateFile()) {
+		return profiles
+	}
+
+	state, err := install.LoadState(i, i.StateFile())
+
+	if err != nil {
+		return profiles
+	}
+
+	for _, p := range state.Profiles {
+		if !slices.Contains(profiles, p) {
+			profiles = append(profiles, p)
+		}
+	}
+
+	return profiles
+}
+
+func RemoveKarabinerRuleFiles() Task {
+	return Task{
+		Name: "Remove Karabiner rule files",
+		Execute: func(i install.Installation) error {
+			files, err := common.ReadDirFromEmbedFS("karabiner")
+
+			if err != nil {
+				return err
+			}
+
+			for _, t := range param.Terminals {
+				files = append(files, t.RuleFile())
+			}
+
+			if i.CustomTerminal != nil {
+				files = append(files, i.CustomTerminal.Terminal().RuleFile())
+			}
+
+			for _, l := range param.AppLaunchers {
+				files = append(files, l.RuleFile())
+			}
+
+			// the rule file of no app launcher had this name before it got a title of its own
+			files = append(files, "app-launcher-none.json")
+
+			for _, file := range files {
+				if file == "default.json" || file == "karabiner-profile.json" || file == "terminal.json" || file == "app-launcher.json" {
+					continue
+				}
+
+				err := removeFile(filepath.Join(i.KarabinerComplexModificationsDir(), file), i)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func RemoveIdeKeymaps() Task {
+	return Task{
+		Name: "Remove IDE keymaps",
+		Execute: func(i install.Installation) error {
+			for _, ide := range param.IDEKeymaps {
+				for _, path := range i.IdeKeymapPaths(ide) {
+					err := removeInstalledFile(i.SourceKeymap(ide), path, i)
+
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func RevertSystemSettings() Task {
+	return Task{
+		Name: "Revert system settings",
+		Execute: func(i install.Installation) error {
+			for _, setting := range systemSettings {
+				if setting.asset != "" {
+					err := removeInstalledFile(filepath.Join("system", filepath.Base(setting.asset)), filepath.Join(i.LibraryDir(), setting.asset), i)
+
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// Without state it is unknown which keys PCfy changed, and deleting them all would wipe values set by hand.
+			if !i.FileExists(i.StateFile()) {
+				i.TryLog(install.WarnMsg, "No installation state found. Leaving the defaults keys as they are...")
+				return nil
+			}
+
+			state, err := install.LoadState(i, i.StateFile())
+
+			if err != nil {
+				return err
+			}
+
+			settings := slices.Clone(systemSettings)
+			setting, _ := functionKeysSetting(param.Standard)
+			settings = append(settings, setting)
+
+			for _, l := range param.AppLaunchers {
+				if setting, found := appLauncherSetting(l); found {
+					settings = append(settings, setting)
+				}
+			}
+
+			return revertSystemSettings(i, settings, state)
+		},
+	}
+}
+
+func RemoveHidutilRemappingFile() Task {
+	return Task{
+		Name: "Remove hidutil remapping file",
+		Execute: func(i install.Installation) error {
+			return removeFile(filepath.Join(i.LaunchAgents(), "com.github.pcfy-my-mac.plist"), i)
+		},
+	}
+}
+
+func ResetHidutil() Task {
+	return Task{
+		Name: "Reset hidutil key mapping",
+		Execute: func(i install.Installation) error {
+			_, err := i.Run(resetHidutilCommand)
+			return err
+		},
+	}
+}
+
+// revertSystemSettings restores the defaults values recorded in state. Keys not recorded are left alone.
+func revertSystemSettings(i install.Installation, settings []SystemSetting, state *install.State) error {
+	restarted := map[string]bool{}
+
+	for _, setting := range settings {
+		reverted := false
+
+		for _, key := range setting.defaults {
+			recorded, found := state.FindDefaults(key.domain, key.key)
+
+			if !found {
+				continue
+			}
+
+			if _, err := i.Run(key.restoreCommand(recorded.Previous)); err != nil {
+				return err
+			}
+
+			reverted = true
+		}
+
+		if reverted && setting.restart != "" && !restarted[setting.restart] {
+			if err := closeApp(i, setting.restart); err != nil {
+				return err
+			}
+
+			restarted[setting.restart] = true
+		}
+	}
+
+	return nil
+}
+
+func RemoveInstallationState() Task {
+	return Task{
+		Name: "Remove installation state",
+		Execute: func(i install.Installation) error {
+			return removeFile(i.StateFile(), i)
+		},
+	}
+}
+
+func removeFile(path string, i install.Installation) error {
+	if !i.FileExists(path) {
+		return nil
+	}
+
+	i.TryLog(install.FileMsg, fmt.Sprintf("Remove file %s", loggedPath(path, i)))
+	return i.RemoveFile(path)
+}
+
+// removeInstalledFile removes path only if it still holds the embedded asset, so files the
+// user changed after installation are left alone.
+func removeInstalledFile(asset, path string, i install.Installation) error {
+	if !i.FileExists(path) {
+		return nil
+	}
+
+	expected, _ := common.ReadFileFromEmbedFS(asset)
+	actual, err := i.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal([]byte(expected), actual) {
+		i.TryLog(install.WarnMsg, fmt.Sprintf("%s was modified after installation. Skipping...", loggedPath(path, i)))
+		return nil
+	}
+
+	return removeFile(path, i)
+}
@@ -0,0 +1,98 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+func ValidateKarabinerRules() Task {
+	return Task{
+		Name:  "Validate Karabiner rules",
+		Group: GroupKarabiner,
+		Execute: func(i install.Installation) error {
+			problems, err := LintBundledKarabinerFiles()
+
+			if err != nil {
+				return err
+			}
+
+			if i.CustomTerminal != nil {
+				t := i.CustomTerminal.Terminal()
+				problems = append(problems, LintKarabinerFile(t.RuleFile(), []byte(terminalRuleFile(t)))...)
+			}
+
+			if len(i.CustomRules) > 0 {
+				data, err := json.Marshal(karabiner.RuleSet{Title: "Custom rules", Rules: customRules(i.CustomRules)})
+
+				if err != nil {
+					return err
+				}
+
+				problems = append(problems, LintKarabinerFile("custom-rules", data)...)
+			}
+
+			if len(problems) > 0 {
+				return errors.New("Invalid Karabiner rules:\n" + strings.Join(problems, "\n"))
+			}
+
+			return nil
+		},
+	}
+}
+
+// LintKarabinerFile returns the problems found in a Karabiner rule file, profile or config, prefixed with its name.
+func LintKarabinerFile(name string, data []byte) []string {
+	lintErrors, err := karabiner.Lint(data)
+
+	if err != nil {
+		return []string{name + ": " + err.Error()}
+	}
+
+	var problems []string
+
+	for _, e := range lintErrors {
+		problems = append(problems, name+": "+e.Error())
+	}
+
+	return problems
+}
+
+// LintBundledKarabinerFiles lints the karabiner assets, and the rule files generated from the terminal.json and
+// app-launcher.json templates for every registered terminal and app launcher rather than the templates themselves.
+func LintBundledKarabinerFiles() ([]string, error) {
+	files, err := common.ReadDirFromEmbedFS("karabiner")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	for _, file := range files {
+		if slices.Contains(karabinerTemplates, file) {
+			continue
+		}
+
+		data, _ := common.ReadFileFromEmbedFS(filepath.Join("karabiner", file))
+		problems = append(problems, LintKarabinerFile(filepath.Join("karabiner", file), []byte(data))...)
+	}
+
+	for _, t := range param.Terminals {
+		problems = append(problems, LintKarabinerFile(t.RuleFile(), []byte(terminalRuleFile(t)))...)
+	}
+
+	for _, l := range param.AppLaunchers {
+		problems = append(problems, LintKarabinerFile(l.RuleFile(), []byte(appLauncherRuleFile(l)))...)
+	}
+
+	return problems, nil
+}
+
+var karabinerTemplates = []string{"terminal.json", "app-launcher.json"}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/raxigan/pcfy-my-mac/cmd"
 	"github.com/raxigan/pcfy-my-mac/cmd/common"
 	"github.com/raxigan/pcfy-my-mac/cmd/install"
 	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"github.com/raxigan/pcfy-my-mac/cmd/task"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -17,31 +21,129 @@ var (
 	commit    string
 )
 
+var commands = []string{"install", "uninstall", "export-rules", "validate", "doctor", "status"}
+
 func main() {
 
+	cmd.Version = version
+	command, args := splitCommand(os.Args[1:])
+
 	showVersion := flag.Bool("version", false, "Show version information")
 	verbose := flag.Bool("verbose", false, "Enable verbose mode")
 	showSampleYaml := flag.Bool("show-sample-yaml", false, "Show sample yaml config")
 	paramsFile := flag.String("params", "", "Path to a YAML file containing installer parameters")
-	flag.Parse()
+	dryRun := flag.Bool("dry-run", false, "Show what the installation would do without changing anything")
+	only := flag.String("only", "", "Comma-separated task groups to install: "+strings.Join(task.Groups, ", "))
+	skip := flag.String("skip", "", "Comma-separated task groups not to install")
+	logFormat := flag.String("log-format", install.TextLogFormat, "Console log format: "+strings.Join(install.LogFormats, ", "))
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
 
 	handleVersionFlag(showVersion)
 	handleSampleYamlFlag(showSampleYaml)
 
 	commander := install.NewDefaultCommander(*verbose)
+	commander.Format = *logFormat
+
+	if !slices.Contains(install.LogFormats, *logFormat) {
+		handleError(errors.New("Unknown log format: "+*logFormat), commander)
+	}
+
+	if !slices.Contains(commands, command) {
+		handleError(errors.New("Unknown command: "+command), commander)
+	}
+
+	openLog(commander, command)
+
+	switch command {
+	case "install":
+		runInstall(commander, *paramsFile, *dryRun, cmd.TaskGroups{Only: splitList(*only), Skip: splitList(*skip)})
+	case "uninstall":
+		runUninstall(commander, *dryRun)
+	case "export-rules":
+		runExportRules(commander, *paramsFile)
+	case "validate":
+		handleError(cmd.Validate(flag.Args(), commander), commander)
+	case "doctor", "status":
+		handleError(cmd.Doctor(install.DefaultHomeDir(), commander, install.DefaultTimeProvider{}), commander)
+	}
+}
+
+func runInstall(commander *install.DefaultCommander, paramsFile string, dryRun bool, groups cmd.TaskGroups) {
 	commander.Run("clear")
-	params, err := param.CollectParams(*paramsFile)
+	params, err := param.CollectParams(paramsFile, cmd.KarabinerConfig(install.DefaultHomeDir(), install.DefaultFileSystem{}))
 
 	handleError(err, commander)
+
+	if dryRun {
+		handleError(cmd.DryRun(install.DefaultHomeDir(), install.DefaultTimeProvider{}, params, commander.Log, commander.Format, func(i install.Installation) error {
+			return cmd.InstallGroups(i, groups)
+		}), commander)
+		return
+	}
+
 	handleError(cmd.Launch(
 		install.DefaultHomeDir(),
 		commander,
 		install.DefaultTimeProvider{},
 		params,
+		groups,
 	), commander,
 	)
 }
 
+func runExportRules(commander install.Commander, paramsFile string) {
+	params, err := param.CollectParams(paramsFile, cmd.KarabinerConfig(install.DefaultHomeDir(), install.DefaultFileSystem{}))
+
+	handleError(err, commander)
+	handleError(cmd.ExportRules(install.DefaultHomeDir(), commander, params, flag.Arg(0)), commander)
+}
+
+func runUninstall(commander *install.DefaultCommander, dryRun bool) {
+	if dryRun {
+		handleError(cmd.DryRun(install.DefaultHomeDir(), install.DefaultTimeProvider{}, cmd.InstalledParams(install.DefaultHomeDir()), commander.Log, commander.Format, cmd.Uninstall), commander)
+		return
+	}
+
+	commander.Run("clear")
+	handleError(cmd.LaunchUninstall(install.DefaultHomeDir(), commander, install.DefaultTimeProvider{}), commander)
+}
+
+// openLog keeps a full log of every run, so failed installations can be diagnosed afterwards.
+// The run goes on without it if the file cannot be created.
+func openLog(commander *install.DefaultCommander, command string) {
+	path := install.DefaultHomeDir().LogFile(command, time.Now())
+
+	if err := commander.OpenLog(path); err != nil {
+		commander.TryLog(install.WarnMsg, "Could not create log file: "+err.Error())
+	}
+}
+
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+
+	return "install", args
+}
+
+func splitList(list string) []string {
+	var result []string
+
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [install|uninstall|doctor|validate|export-rules] [flags]\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
 func handleSampleYamlFlag(showSampleYaml *bool) {
 	if *showSampleYaml {
 		printSampleYaml()
@@ -0,0 +1,71 @@
+package install_test
+
+import (
+	"github.com/raxigan/pcfy-my-mac/cmd"
+	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"github.com/raxigan/pcfy-my-mac/cmd/task"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportRules(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "default",
+		KeyboardLayout: "mac",
+		CustomRules: []param.CustomRule{{
+			From: param.Key{KeyCode: "k", Modifiers: []string{"left_control"}},
+			To:   param.Key{KeyCode: "k", Modifiers: []string{"left_command"}},
+		}},
+	}
+
+	path := filepath.Join(t.TempDir(), "pcfy.json")
+	_, err := captureOutput(func() error {
+		return cmd.ExportRules(testHomeDir(), install.NewDefaultCommander(true), params, path)
+	})
+	assert.NoError(t, err)
+
+	data, _ := os.ReadFile(path)
+	ruleSet, err := karabiner.ParseRuleSet(data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "PCfy", ruleSet.Title)
+	assert.Equal(t, "left_control+k to left_command+k", ruleSet.Rules[0].Description)
+	assert.Contains(t, string(data), `"description": "Win (Open Spotlight)"`)
+	assert.NotContains(t, string(data), "is_built_in_keyboard")
+	assert.Empty(t, task.LintKarabinerFile("pcfy.json", data))
+}
+
+func TestExportRulesDoesNotAskForRuleConflicts(t *testing.T) {
+
+	task.AskConflictResolution = func(conflict string) string {
+		t.Fatal("rule conflict asked for in an export")
+		return param.KeepUser
+	}
+	defer func() { task.AskConflictResolution = askConflictResolution }()
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		CustomRules: []param.CustomRule{{
+			From: param.Key{KeyCode: "q", Modifiers: []string{"left_control"}},
+			To:   param.Key{KeyCode: "q", Modifiers: []string{"left_command"}},
+		}},
+		RuleConflicts: "ask",
+	}
+
+	path := filepath.Join(t.TempDir(), "pcfy.json")
+	_, err := captureOutput(func() error {
+		return cmd.ExportRules(testHomeDir(), install.NewDefaultCommander(true), params, path)
+	})
+	assert.NoError(t, err)
+
+	data, _ := os.ReadFile(path)
+	assert.Contains(t, string(data), `"description": "Disable Ctrl + Q (Quit app)"`)
+}
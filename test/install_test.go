@@ -1,18 +1,28 @@
 package install_test
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/raxigan/pcfy-my-mac/cmd"
 	"github.com/raxigan/pcfy-my-mac/cmd/common"
 	"github.com/raxigan/pcfy-my-mac/cmd/install"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
 	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"github.com/raxigan/pcfy-my-mac/cmd/task"
 	"github.com/raxigan/pcfy-my-mac/test/test_utils"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -73,6 +83,49 @@ func TestInstallWithPcKeyboardLayout(t *testing.T) {
 	test_utils.AssertFilesEqual(t, actual, expected)
 }
 
+func TestInstallWithKeyboardLayoutPerDevice(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		Keyboards: []param.Keyboard{
+			{VendorID: 1452, ProductID: 833, Layout: "mac", Description: "Magic Keyboard"},
+			{VendorID: 1133, ProductID: 49948, Layout: "pc"},
+		},
+	}
+
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"device_if","identifiers":[{"is_built_in_keyboard":true,"description":"MacBook built-in keyboard"},{"vendor_id":1452,"product_id":833,"description":"Magic Keyboard"}]}]`,
+		swapConditions(t, home))
+
+	params.KeyboardLayout = "mac"
+	home, _, err = runInstaller(t, params)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, `[{"type":"device_unless","identifiers":[{"vendor_id":1133,"product_id":49948}]}]`, swapConditions(t, home))
+}
+
+// swapConditions returns the conditions of the first Opt/Cmd swap manipulator.
+func swapConditions(t *testing.T, home install.HomeDir) string {
+	config, err := karabiner.LoadConfig(home.KarabinerConfigFile())
+	assert.NoError(t, err)
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		if strings.HasPrefix(r.Description, "Opt & Cmd swap") {
+			data, _ := json.Marshal(r.Manipulators[0].Conditions)
+			return string(data)
+		}
+	}
+
+	return ""
+}
+
 func TestInstallWithUnknownKeyboardLayout(t *testing.T) {
 
 	params := param.Params{
@@ -87,11 +140,85 @@ func TestInstallWithUnknownKeyboardLayout(t *testing.T) {
 	home, _, err := runInstaller(t, params)
 
 	test_utils.AssertErrorContains(t, err, "Unknown keyboard layout: unknown")
+	test_utils.AssertErrorContains(t, err, `Rolled back:
+		 • Install Karabiner rule files`)
 
-	actual := home.KarabinerConfigFile()
-	expected := "expected/karabiner-pc-keyboard-layout.json"
+	assert.NoFileExists(t, home.KarabinerConfigFile())
+	assert.NoFileExists(t, home.KarabinerConfigBackupFile(test_utils.FakeTimeProvider{}.Now()))
+	assert.NoFileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), "main.json"))
+}
 
-	test_utils.AssertFilesEqual(t, actual, expected)
+func TestFailedInstallRestoresExistingKarabinerConfig(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	t.Setenv("PCFY_FAILING_COMMAND", "open -a Rectangle")
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+
+	home, output, err := runInstaller(t, params)
+
+	test_utils.AssertErrorContains(t, err, "Command failed with exit code 3: open -a Rectangle")
+	test_utils.AssertErrorContains(t, err, " • Update Karabiner config")
+	test_utils.AssertFilesEqual(t, home.KarabinerConfigFile(), "assets/custom.json")
+	assert.Contains(t, output, "Roll back: Update Karabiner config\nopen -a Karabiner-Elements")
+}
+
+func TestFailedCommandStopsInstallation(t *testing.T) {
+
+	t.Setenv("PCFY_FAILING_COMMAND", "open -a Rectangle")
+
+	_, output, err := runInstaller(t, param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+
+	var cmdErr *install.CommandError
+
+	assert.True(t, errors.As(err, &cmdErr))
+	assert.Equal(t, "open -a Rectangle", cmdErr.Command)
+	assert.Equal(t, 3, cmdErr.Result.ExitCode)
+	assert.Equal(t, "Unable to find application named 'Rectangle'\n", cmdErr.Result.Stderr)
+	assert.Contains(t, err.Error(), "Command failed with exit code 3: open -a Rectangle\nUnable to find application named 'Rectangle'")
+	assert.Contains(t, err.Error(), "Rolled back:\n • Open Rectangle.app\n • Install Rectangle preferences\n")
+	assert.NotContains(t, output, "Close AtlTab.app")
+}
+
+func TestDeclinedDependenciesStopInstallation(t *testing.T) {
+
+	t.Setenv("PCFY_MISSING_APPS", "Rectangle.app")
+	confirm := task.ConfirmDependencies
+	task.ConfirmDependencies = func(dependencies []string) bool { return false }
+	defer func() { task.ConfirmDependencies = confirm }()
+
+	home, output, err := runInstaller(t, param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+
+	var declined *task.DependenciesDeclinedError
+
+	assert.True(t, errors.As(err, &declined))
+	assert.Equal(t, []string{"Rectangle"}, declined.Dependencies)
+	assert.NotContains(t, output, "brew install")
+	assert.NoFileExists(t, home.KarabinerConfigFile())
 }
 
 func TestInstallWithSpotlightAppLauncher(t *testing.T) {
@@ -151,6 +278,235 @@ func TestInstallWithAlfredAppLauncher(t *testing.T) {
 	test_utils.AssertFilesEqual(t, actual, expected)
 }
 
+func TestInstallAlfredPreferencesInSyncFolder(t *testing.T) {
+
+	home := testHomeDir()
+	syncFolder := filepath.Join(home.Path, "Dropbox")
+	prefsFile := filepath.Join(home.ApplicationSupportDir(), "Alfred/prefs.json")
+	prefs, _ := os.ReadFile(prefsFile)
+	t.Cleanup(func() { os.RemoveAll(syncFolder); os.WriteFile(prefsFile, prefs, 0644) })
+
+	os.WriteFile(prefsFile, []byte(`{"current": "~/Dropbox/Alfred.alfredpreferences", "localhash": "this-mac"}`), 0644)
+	hotkey := `<plist version="1.0"><dict><key>default</key><dict><key>key</key><integer>44</integer></dict><key>hidden</key><true/></dict></plist>`
+
+	for _, hash := range []string{"this-mac", "other-mac"} {
+		dir := filepath.Join(syncFolder, "Alfred.alfredpreferences/preferences/local", hash)
+		os.MkdirAll(filepath.Join(dir, "hotkey"), 0755)
+		os.WriteFile(filepath.Join(dir, "hotkey/prefs.plist"), []byte(hotkey), 0644)
+	}
+
+	_, output, err := runInstaller(t, param.Params{
+		AppLauncher:    "alfred",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "plutil -replace default -xml '<dict><key>key</key><integer>49</integer><key>mod</key><integer>524288</integer><key>string</key><string></string></dict>' ~/Dropbox/Alfred.alfredpreferences/preferences/local/this-mac/hotkey/prefs.plist")
+	assert.NotContains(t, output, "other-mac")
+	assert.NotContains(t, output, "Copy file alfred/prefs.plist")
+}
+
+func TestInstallKeepsMatchingAlfredHotkey(t *testing.T) {
+
+	home := testHomeDir()
+	hotkeyFile := filepath.Join(home.ApplicationSupportDir(), "Alfred/Alfred.alfredpreferences/preferences/local/64185304872debd80b4a1545f17ff4716b29e2d4/hotkey/prefs.plist")
+	os.MkdirAll(filepath.Dir(hotkeyFile), 0755)
+	os.WriteFile(hotkeyFile, []byte(`<plist version="1.0">
+<dict>
+	<key>default</key>
+	<dict>
+		<key>key</key>
+		<integer>49</integer>
+		<key>mod</key>
+		<integer>524288</integer>
+		<key>string</key>
+		<string></string>
+	</dict>
+	<key>hidden</key>
+	<true/>
+</dict>
+</plist>`), 0644)
+
+	_, output, err := runInstaller(t, param.Params{
+		AppLauncher:    "alfred",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "plutil -replace")
+	assert.Contains(t, output, "Install app launcher preferences\nunchanged")
+}
+
+func TestInstallReplacesAlfredHotkeyInTruncatedPreferences(t *testing.T) {
+
+	home := testHomeDir()
+	hotkeyFile := filepath.Join(home.ApplicationSupportDir(), "Alfred/Alfred.alfredpreferences/preferences/local/64185304872debd80b4a1545f17ff4716b29e2d4/hotkey/prefs.plist")
+	os.MkdirAll(filepath.Dir(hotkeyFile), 0755)
+	os.WriteFile(hotkeyFile, []byte(`<plist version="1.0"><dict><key>default</key><string`), 0644)
+
+	_, output, err := runInstaller(t, param.Params{
+		AppLauncher:    "alfred",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "plutil -replace default -xml")
+}
+
+func TestInstallWithRaycastAppLauncher(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "raycast",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	home, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	rules := map[string]karabiner.Rule{}
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		rules[r.Description] = r
+	}
+
+	toIfAlone := []karabiner.Event{{KeyCode: "spacebar", Modifiers: karabiner.ModifierList{"option"}}}
+	assert.Equal(t, toIfAlone, rules["Win (Open Raycast)"].Manipulators[0].ToIfAlone)
+	assert.Equal(t, toIfAlone, rules["Opt & Cmd swap (Raycast)"].Manipulators[0].ToIfAlone)
+	assert.FileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), "raycast.json"))
+	assert.Contains(t, output, "defaults write com.raycast.macos raycastGlobalHotkey -string Option-49")
+	assert.Contains(t, output, "killall Raycast\nopen -a Raycast")
+}
+
+func TestInstallWithNoAppLauncher(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	rules := map[string]karabiner.Rule{}
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		rules[r.Description] = r
+	}
+
+	assert.Empty(t, rules["Win (No app launcher)"].Manipulators[0].ToIfAlone)
+	assert.Contains(t, rules, "Opt & Cmd swap (No app launcher)")
+	assert.FileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), "no-app-launcher.json"))
+}
+
+func TestInstallWithPreset(t *testing.T) {
+
+	params := param.Params{
+		Preset:         "windows",
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	rectangle := test_utils.ReadFile(filepath.Join(home.PreferencesDir(), "com.knollsoft.Rectangle.plist"))
+	assert.Contains(t, rectangle, "<key>leftHalf</key>\n\t<dict><key>keyCode</key><integer>123</integer><key>modifierFlags</key><integer>1048576</integer></dict>")
+	assert.Contains(t, rectangle, "<key>restore</key>\n\t<dict><key>keyCode</key><integer>125</integer><key>modifierFlags</key><integer>1048576</integer></dict>")
+
+	altTab := test_utils.ReadFile(filepath.Join(home.PreferencesDir(), "com.lwouis.alt-tab-macos.plist"))
+	assert.Contains(t, altTab, "<key>theme</key>\n        <string>1</string>")
+	assert.Contains(t, altTab, "<key>spacesToShow</key>\n        <string>1</string>")
+}
+
+func TestInstallWithPresetAndCustomRules(t *testing.T) {
+
+	params := param.Params{
+		Preset:         "xfce",
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "none",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		CustomRules: []param.CustomRule{{
+			Description: "Ctrl + Alt + T (Open Terminal)",
+			From:        param.Key{KeyCode: "t", Modifiers: []string{"left_control", "option"}},
+			To:          param.Key{KeyCode: "t", Modifiers: []string{"left_command"}},
+		}},
+	}
+
+	home, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	var descriptions []string
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		descriptions = append(descriptions, r.Description)
+	}
+
+	assert.Subset(t, descriptions, []string{"Ctrl + Alt + T (Open Terminal)", "Ctrl + Alt + L (Lock Screen)", "Alt + F2 (Run dialog)"})
+	assert.Contains(t, output, "add 1 custom rules in profile \"PCfy\"")
+	assert.Contains(t, output, "add 2 preset rules in profile \"PCfy\"")
+}
+
+func TestInstallWithRuleConflictsOnPresetRule(t *testing.T) {
+
+	presets := param.Presets
+	t.Cleanup(func() { param.Presets = presets })
+	param.Presets = append(slices.Clone(presets), param.Preset{
+		Name: "Test",
+		CustomRules: []param.CustomRule{{
+			Description: "Ctrl + Q (Quit app)",
+			From:        param.Key{KeyCode: "q", Modifiers: []string{"left_control"}},
+			To:          param.Key{KeyCode: "q", Modifiers: []string{"left_command"}},
+		}},
+	})
+
+	_, output, err := runInstaller(t, param.Params{
+		Preset:         "test",
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		RuleConflicts:  "keep-pcfy",
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Rule \"Disable Ctrl + Q (Quit app)\" overlaps preset rule \"Ctrl + Q (Quit app)\" on control + q")
+	assert.Contains(t, output, "skip preset rule \"Ctrl + Q (Quit app)\" overlapping rule \"Disable Ctrl + Q (Quit app)\"")
+	assert.NotContains(t, output, "custom rule")
+	assert.NotContains(t, output, "preset rules in profile")
+}
+
 func TestInstallWithUnknownAppLauncher(t *testing.T) {
 
 	params := param.Params{
@@ -224,83 +580,1077 @@ func TestInstallWithWarpTerminal(t *testing.T) {
 	test_utils.AssertFilesEqual(t, actual, expected)
 }
 
-func TestInstallAndDoNotCreateNewKarabinerConfigIfItAlreadyExists(t *testing.T) {
+func TestInstallWithRegisteredTerminals(t *testing.T) {
+
+	for _, terminal := range param.Terminals {
+		params := param.Params{
+			AppLauncher:    "none",
+			Terminal:       terminal.Name,
+			KeyboardLayout: "pc",
+			Keymaps:        []string{},
+			Blacklist:      []string{},
+			SystemSettings: []string{},
+		}
+
+		home, _, err := runInstaller(t, params)
+		assert.NoError(t, err)
+
+		config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+		rule := config.Profile("PCfy").ComplexModifications.Rules[0]
+
+		assert.Equal(t, "Ctrl + Alt + T (Open "+terminal.Title+")", rule.Description)
+		assert.Equal(t, "open -a "+strings.TrimSuffix(terminal.App, ".app"), rule.Manipulators[0].To[0].ShellCommand)
+		assert.FileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), terminal.RuleFile()))
+
+		for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+			if r.Description == "Ctrl + Left Arrow" {
+				assert.Contains(t, r.Manipulators[0].Conditions[0].BundleIdentifiers, "^"+regexp.QuoteMeta(terminal.BundleID)+"$")
+			}
+		}
+
+		tearDown(home)
+	}
+}
+
+func TestInstallWithCustomTerminal(t *testing.T) {
 
 	params := param.Params{
 		AppLauncher:    "none",
-		Terminal:       "none",
+		Terminal:       "Acme Term",
+		CustomTerminal: &param.CustomTerminal{App: "Acme Term.app", BundleID: "com.acme.term", Args: []string{"--profile", "it's me"}},
 		KeyboardLayout: "pc",
 		Keymaps:        []string{},
 		Blacklist:      []string{},
 		SystemSettings: []string{},
 	}
 
-	homeDir := testHomeDir()
-	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
-	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+	home, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
 
-	home, _, _ := runInstaller(t, params)
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	rules := map[string]karabiner.Rule{}
 
-	actual := home.KarabinerConfigFile()
-	expected := "expected/karabiner-pc-keyboard-layout-with-custom.json"
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		rules[r.Description] = r
+	}
 
-	test_utils.AssertFilesEqual(t, actual, expected)
+	assert.Equal(t, `open -a 'Acme Term' --args --profile 'it'\''s me'`, rules["Ctrl + Alt + T (Open Acme Term)"].Manipulators[0].To[0].ShellCommand)
+	assert.Contains(t, rules["Ctrl + Left Arrow"].Manipulators[0].Conditions[0].BundleIdentifiers, `^com\.acme\.term$`)
+	assert.NotContains(t, rules["Alt + F4"].Manipulators[0].Conditions, karabiner.Condition{Type: "frontmost_application_unless", BundleIdentifiers: []string{`^com\.acme\.term$`}})
+	assert.FileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), "acme-term.json"))
+	assert.Contains(t, output, "exclude Acme Term from 6 rules of main.json")
 }
 
-func TestInstallMany(t *testing.T) {
+func TestInstallWithCustomRules(t *testing.T) {
 
 	params := param.Params{
-		AppLauncher:    "alfred",
-		Terminal:       "warp",
+		AppLauncher:    "none",
+		Terminal:       "none",
 		KeyboardLayout: "pc",
-		Keymaps:        param.IdeKeymapOptions(),
-		Blacklist:      []string{"com.spotify.client", "com.apple.finder", "com.apple.AppStore"},
-		SystemSettings: []string{
-			"Enable Dock auto-hide (2s delay)",
-			"change-dock-minimize-animation-to-scale",
-			"Enable Home and End keys",
-			"Show hidden files in Finder",
-			"Show directories on top in Finder",
-			"Show full POSIX paths in Finder window title",
-		},
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		CustomRules: []param.CustomRule{{
+			Description:  "Ctrl + K (Clear terminal)",
+			From:         param.Key{KeyCode: "k", Modifiers: []string{"left_control"}},
+			To:           param.Key{KeyCode: "k", Modifiers: []string{"left_command"}},
+			ExcludedApps: []string{"com.googlecode.iterm2"},
+		}},
 	}
 
-	home, output, _ := runInstaller(t, params)
-	fmt.Println(output == "")
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	rule := config.Profile("PCfy").ComplexModifications.Rules[0]
+	data, _ := json.Marshal(rule)
+
+	assert.JSONEq(t, `{
+		"description": "Ctrl + K (Clear terminal)",
+		"manipulators": [{
+			"type": "basic",
+			"from": {"key_code": "k", "modifiers": {"mandatory": ["left_control"]}},
+			"to": [{"key_code": "k", "modifiers": ["left_command"]}],
+			"conditions": [{"type": "frontmost_application_unless", "bundle_identifiers": ["^com\\.googlecode\\.iterm2$"]}]
+		}]
+	}`, string(data))
+}
 
-	actual := home.KarabinerConfigFile()
-	expected := "expected/karabiner-alfred-warp-pc.json"
+func TestInstallWithCustomRuleSendingAppleVendorKey(t *testing.T) {
 
-	test_utils.AssertFilesEqual(t, actual, expected)
-	test_utils.AssertFilesEqual(t, filepath.Join(home.PreferencesDir(), "com.knollsoft.Rectangle.plist"), "../assets/rectangle/com.knollsoft.Rectangle.plist")
-	test_utils.AssertFilesEqual(t, filepath.Join(home.PreferencesDir(), "com.lwouis.alt-tab-macos.plist"), "expected/com.lwouis.alt-tab-macos.plist")
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		CustomRules: []param.CustomRule{{
+			Description: "Alt + F2 (Run dialog)",
+			From:        param.Key{KeyCode: "f2", Modifiers: []string{"option"}},
+			To:          param.Key{KeyCode: "spotlight"},
+		}},
+	}
 
-	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.IntelliJ())), home.IdeKeymapPaths(param.IntelliJ())[0])
-	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.IntelliJ())), home.IdeKeymapPaths(param.IntelliJ())[1])
-	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.IntelliJCE())), home.IdeKeymapPaths(param.IntelliJCE())[0])
-	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.GoLand())), home.IdeKeymapPaths(param.GoLand())[0])
-	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.Fleet())), home.IdeKeymapPaths(param.Fleet())[0])
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
 
-	test_utils.AssertFilesEqual(t, "../assets/system/com.github.pcfy-my-mac.plist", filepath.Join(home.LaunchAgents(), "com.github.pcfy-my-mac.plist"))
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	rule := config.Profile("PCfy").ComplexModifications.Rules[0]
 
-	expected = test_utils.ReadFile("expected/output.txt")
-	assert.Equal(t, expected, output)
+	assert.Equal(t, []karabiner.Event{{AppleVendorKeyboardKeyCode: "spotlight"}}, rule.Manipulators[0].To)
 }
 
-func runInstaller(t *testing.T, params param.Params) (install.HomeDir, string, error) {
-	common.ExecCommand = fakeExecCommand
-	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
-	os.Setenv("HOME", testHomeDir().Path)
-	defer func() { common.ExecCommand = exec.Command }()
-	commander := install.NewDefaultCommander(true)
-	homeDir := testHomeDir()
-	var err error = nil
-	output, err := captureOutput(func() error {
-		err := cmd.Launch(homeDir, commander, test_utils.FakeTimeProvider{}, params)
-		return err
-	})
-	t.Cleanup(func() { tearDown(homeDir) })
-	return homeDir, output, err
+func TestInstallWithExcludedApps(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		ExcludedApps:   []string{`^com\.microsoft\.VSCode$`, `^com\.jetbrains`},
+	}
+
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	rules := map[string]karabiner.Rule{}
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		rules[r.Description] = r
+	}
+
+	assert.Equal(t, []karabiner.Condition{{
+		Type:              "frontmost_application_unless",
+		BundleIdentifiers: []string{`^com\.jetbrains`, `^com\.googlecode\.iterm2$`, `^com\.apple\.Terminal$`, `^com\.google\.android\.studio$`, `^com\.microsoft\.VSCode$`},
+	}}, rules["Ctrl + Left Arrow"].Manipulators[0].Conditions)
+
+	assert.Equal(t, []karabiner.Condition{{
+		Type:              "frontmost_application_unless",
+		BundleIdentifiers: []string{`^com\.microsoft\.VSCode$`, `^com\.jetbrains`},
+	}}, rules["Alt + F4"].Manipulators[0].Conditions)
+
+	assert.Equal(t, "frontmost_application_if", rules["F2 to rename in Finder"].Manipulators[0].Conditions[0].Type)
+	assert.Len(t, rules["F2 to rename in Finder"].Manipulators[0].Conditions, 1)
+}
+
+func TestInstallWithExcludedKarabinerRules(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		ExcludedRules:  []string{"alt-f4", "finder-f2-to-rename"},
+	}
+
+	home, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	var descriptions []string
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		descriptions = append(descriptions, r.Description)
+	}
+
+	assert.NotContains(t, descriptions, "Alt + F4")
+	assert.NotContains(t, descriptions, "F2 to rename in Finder")
+	assert.Contains(t, descriptions, "Win + L (Lock Screen)")
+	assert.Contains(t, output, "add 16 rules from main.json")
+	assert.Contains(t, output, "add 4 rules from finder.json")
+}
+
+func TestInstallWithRuleConflictsKeepUser(t *testing.T) {
+
+	descriptions, output := installWithRuleConflicts(t, "keep-user")
+
+	assert.Contains(t, output, `Rule "Alt + F4" overlaps rule "Close window" of profile "Custom" on option + f4. Resolving with keep-user`)
+	assert.Contains(t, output, `Rule "Disable Ctrl + Q (Quit app)" overlaps custom rule "Ctrl + Q (Quit app)" on control + q. Resolving with keep-user`)
+	assert.NotContains(t, descriptions, "Alt + F4")
+	assert.NotContains(t, descriptions, "Disable Ctrl + Q (Quit app)")
+	assert.Contains(t, descriptions, "Ctrl + Q (Quit app)")
+	assert.Contains(t, descriptions, "Win + L (Lock Screen)")
+}
+
+func TestInstallWithRuleConflictsKeepPcfy(t *testing.T) {
+
+	descriptions, output := installWithRuleConflicts(t, "keep-pcfy")
+
+	assert.Contains(t, output, `Rule "Disable Ctrl + Q (Quit app)" overlaps custom rule "Ctrl + Q (Quit app)" on control + q. Resolving with keep-pcfy`)
+	assert.Contains(t, output, `skip custom rule "Ctrl + Q (Quit app)" overlapping rule "Disable Ctrl + Q (Quit app)"`)
+	assert.Contains(t, descriptions, "Alt + F4")
+	assert.Contains(t, descriptions, "Disable Ctrl + Q (Quit app)")
+	assert.NotContains(t, descriptions, "Ctrl + Q (Quit app)")
+}
+
+func TestInstallWithRuleConflictsKeepPcfyOverEveryOverlappingRule(t *testing.T) {
+
+	descriptions, output := installWithRuleConflicts(t, "keep-pcfy",
+		param.CustomRule{
+			Description: "Alt + F4 (Close tab)",
+			From:        param.Key{KeyCode: "f4", Modifiers: []string{"left_option"}},
+			To:          param.Key{KeyCode: "w", Modifiers: []string{"left_command"}},
+		},
+		param.CustomRule{
+			Description: "Alt + F4 (Quit app)",
+			From:        param.Key{KeyCode: "f4", Modifiers: []string{"option"}},
+			To:          param.Key{KeyCode: "q", Modifiers: []string{"left_command"}},
+		},
+	)
+
+	assert.Contains(t, output, `Rule "Alt + F4" overlaps rule "Close window" of profile "Custom" on option + f4. Resolving with keep-pcfy`)
+	assert.Contains(t, output, `skip custom rule "Alt + F4 (Close tab)" overlapping rule "Alt + F4"`)
+	assert.Contains(t, output, `skip custom rule "Alt + F4 (Quit app)" overlapping rule "Alt + F4"`)
+	assert.Contains(t, descriptions, "Alt + F4")
+	assert.NotContains(t, descriptions, "Alt + F4 (Close tab)")
+	assert.NotContains(t, descriptions, "Alt + F4 (Quit app)")
+}
+
+func TestInstallWithRuleConflictsInstallingBothByDefault(t *testing.T) {
+
+	descriptions, output := installWithRuleConflicts(t, "")
+
+	assert.Contains(t, output, `Rule "Alt + F4" overlaps rule "Close window" of profile "Custom" on option + f4. Resolving with install-both`)
+	assert.Contains(t, descriptions, "Alt + F4")
+	assert.Contains(t, descriptions, "Disable Ctrl + Q (Quit app)")
+	assert.Equal(t, "Ctrl + Q (Quit app)", descriptions[0])
+}
+
+func TestInstallWithRuleConflictsAsked(t *testing.T) {
+
+	var asked []string
+	task.AskConflictResolution = func(conflict string) string {
+		asked = append(asked, conflict)
+		return param.KeepUser
+	}
+	defer func() { task.AskConflictResolution = askConflictResolution }()
+
+	descriptions, output := installWithRuleConflicts(t, "ask")
+
+	assert.Equal(t, []string{
+		`Rule "Alt + F4" overlaps rule "Close window" of profile "Custom" on option + f4`,
+		`Rule "Disable Ctrl + Q (Quit app)" overlaps custom rule "Ctrl + Q (Quit app)" on control + q`,
+	}, asked)
+	assert.Contains(t, output, "Resolving with keep-user")
+	assert.NotContains(t, descriptions, "Alt + F4")
+}
+
+var askConflictResolution = task.AskConflictResolution
+
+func TestInstallWithRuleConflictsUnderExclusiveConditions(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		CustomRules: []param.CustomRule{{
+			Description: "Ctrl + Backspace (Delete word in iTerm)",
+			From:        param.Key{KeyCode: "delete_or_backspace", Modifiers: []string{"left_control"}},
+			To:          param.Key{KeyCode: "w", Modifiers: []string{"left_control"}},
+			Apps:        []string{"com.googlecode.iterm2"},
+		}},
+		RuleConflicts: "keep-user",
+	}
+
+	_, output, err := runInstaller(t, params)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "overlaps")
+}
+
+func TestInstallWithRuleConflictsOnModifierAliases(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		CustomRules: []param.CustomRule{{
+			Description: "Alt + F4 (Close tab)",
+			From:        param.Key{KeyCode: "f4", Modifiers: []string{"left_alt"}},
+			To:          param.Key{KeyCode: "w", Modifiers: []string{"left_gui"}},
+		}},
+		RuleConflicts: "keep-user",
+	}
+
+	_, output, err := runInstaller(t, params)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, `Rule "Alt + F4" overlaps custom rule "Alt + F4 (Close tab)"`)
+}
+
+func installWithRuleConflicts(t *testing.T, resolution string, custom ...param.CustomRule) ([]string, string) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		CustomRules: []param.CustomRule{{
+			Description: "Ctrl + Q (Quit app)",
+			From:        param.Key{KeyCode: "q", Modifiers: []string{"left_control"}},
+			To:          param.Key{KeyCode: "q", Modifiers: []string{"left_command"}},
+		}},
+		RuleConflicts: resolution,
+	}
+
+	params.CustomRules = append(params.CustomRules, custom...)
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	config, _ := karabiner.LoadConfig("assets/custom.json")
+	config.Profile("Custom").AddRules(karabiner.Rule{
+		Description:  "Close window",
+		Manipulators: []karabiner.Manipulator{{Type: "basic", From: &karabiner.From{KeyCode: "f4", Modifiers: &karabiner.Modifiers{Mandatory: []string{"left_option"}}}}},
+	})
+	data, _ := config.Bytes()
+	os.WriteFile(homeDir.KarabinerConfigFile(), data, 0644)
+
+	_, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ = karabiner.LoadConfig(homeDir.KarabinerConfigFile())
+	var descriptions []string
+
+	for _, r := range config.Profile("PCfy").ComplexModifications.Rules {
+		descriptions = append(descriptions, r.Description)
+	}
+
+	return descriptions, output
+}
+
+func TestInstallWithKarabinerParameters(t *testing.T) {
+
+	timeout, scale, keyboardType := 300, 150, "ISO"
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		KarabinerParameters: &param.KarabinerParameters{
+			ToIfAloneTimeout: &timeout,
+			MouseKeyXYScale:  &scale,
+			KeyboardType:     &keyboardType,
+		},
+	}
+
+	home, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	profile := config.Profile("PCfy")
+
+	assert.Equal(t, map[string]int{"basic.to_if_alone_timeout_milliseconds": 300}, profile.ComplexModifications.Parameters)
+	assert.Equal(t, 150, *profile.VirtualHIDKeyboard.MouseKeyXYScale)
+	assert.Equal(t, "iso", profile.VirtualHIDKeyboard.KeyboardTypeV2)
+	assert.Equal(t, 0, *profile.VirtualHIDKeyboard.CountryCode)
+	assert.Contains(t, output, `set 3 Karabiner parameters in profile "PCfy"`)
+}
+
+func TestInstallWithCustomFunctionKeys(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:        "none",
+		Terminal:           "none",
+		KeyboardLayout:     "pc",
+		Keymaps:            []string{},
+		Blacklist:          []string{},
+		SystemSettings:     []string{},
+		FunctionKeys:       "custom",
+		CustomFunctionKeys: map[string]string{"f2": "f2", "f5": "f5", "f6": "mission_control"},
+	}
+
+	home, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	keys := karabinerFunctionKeys(home)
+
+	assert.Equal(t, karabiner.Event{ConsumerKeyCode: "display_brightness_decrement"}, keys["f1"])
+	assert.Equal(t, karabiner.Event{KeyCode: "f2"}, keys["f2"])
+	assert.Equal(t, karabiner.Event{KeyCode: "f5"}, keys["f5"])
+	assert.Equal(t, karabiner.Event{AppleVendorKeyboardKeyCode: "mission_control"}, keys["f6"])
+	assert.Contains(t, output, "defaults write -g com.apple.keyboard.fnState -bool false")
+}
+
+func TestInstallWithStandardFunctionKeys(t *testing.T) {
+
+	home, output := installWithFunctionKeys(t, "standard")
+	keys := karabinerFunctionKeys(home)
+
+	assert.Len(t, keys, 12)
+	assert.Equal(t, karabiner.Event{ConsumerKeyCode: "display_brightness_decrement"}, keys["f1"])
+	assert.Contains(t, output, `map 12 function keys for standard function keys in profile "PCfy"`)
+	assert.Contains(t, output, "defaults write -g com.apple.keyboard.fnState -bool true")
+}
+
+func TestInstallWithMediaFunctionKeys(t *testing.T) {
+
+	home, output := installWithFunctionKeys(t, "media")
+	keys := karabinerFunctionKeys(home)
+
+	assert.Len(t, keys, 12)
+	assert.Equal(t, karabiner.Event{ConsumerKeyCode: "display_brightness_decrement"}, keys["f1"])
+	assert.Contains(t, output, `map 12 function keys for media function keys in profile "PCfy"`)
+	assert.Contains(t, output, "defaults write -g com.apple.keyboard.fnState -bool false")
+}
+
+func installWithFunctionKeys(t *testing.T, mode string) (install.HomeDir, string) {
+
+	home, output, err := runInstaller(t, param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+		FunctionKeys:   mode,
+	})
+
+	assert.NoError(t, err)
+	return home, output
+}
+
+func karabinerFunctionKeys(home install.HomeDir) map[string]karabiner.Event {
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	keys := map[string]karabiner.Event{}
+
+	for _, k := range config.Profile("PCfy").FnFunctionKeys {
+		keys[k.From.KeyCode] = k.To[0]
+	}
+
+	return keys
+}
+
+func TestInstallAndDoNotCreateNewKarabinerConfigIfItAlreadyExists(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+
+	home, _, _ := runInstaller(t, params)
+
+	actual := home.KarabinerConfigFile()
+	expected := "expected/karabiner-pc-keyboard-layout-with-custom.json"
+
+	test_utils.AssertFilesEqual(t, actual, expected)
+}
+
+func TestInstallMany(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "alfred",
+		Terminal:       "warp",
+		KeyboardLayout: "pc",
+		Keymaps:        param.IdeKeymapOptions(),
+		Blacklist:      []string{"com.spotify.client", "com.apple.finder", "com.apple.AppStore"},
+		SystemSettings: []string{
+			"Enable Dock auto-hide (2s delay)",
+			"change-dock-minimize-animation-to-scale",
+			"Enable Home and End keys",
+			"Show hidden files in Finder",
+			"Show directories on top in Finder",
+			"Show full POSIX paths in Finder window title",
+		},
+	}
+
+	home, output, _ := runInstaller(t, params)
+	fmt.Println(output == "")
+
+	actual := home.KarabinerConfigFile()
+	expected := "expected/karabiner-alfred-warp-pc.json"
+
+	test_utils.AssertFilesEqual(t, actual, expected)
+	test_utils.AssertFilesEqual(t, filepath.Join(home.PreferencesDir(), "com.knollsoft.Rectangle.plist"), "../assets/rectangle/com.knollsoft.Rectangle.plist")
+	test_utils.AssertFilesEqual(t, filepath.Join(home.PreferencesDir(), "com.lwouis.alt-tab-macos.plist"), "expected/com.lwouis.alt-tab-macos.plist")
+
+	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.IntelliJ())), home.IdeKeymapPaths(param.IntelliJ())[0])
+	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.IntelliJ())), home.IdeKeymapPaths(param.IntelliJ())[1])
+	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.IntelliJCE())), home.IdeKeymapPaths(param.IntelliJCE())[0])
+	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.GoLand())), home.IdeKeymapPaths(param.GoLand())[0])
+	test_utils.AssertFilesEqual(t, filepath.Join("../assets", home.SourceKeymap(param.Fleet())), home.IdeKeymapPaths(param.Fleet())[0])
+
+	test_utils.AssertFilesEqual(t, "../assets/system/com.github.pcfy-my-mac.plist", filepath.Join(home.LaunchAgents(), "com.github.pcfy-my-mac.plist"))
+
+	expected = test_utils.ReadFile("expected/output.txt")
+	assert.Equal(t, expected, output)
+}
+
+func TestReinstallChangesNothing(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "default",
+		KeyboardLayout: "mac",
+		Keymaps:        []string{"GoLand"},
+		Blacklist:      []string{"com.spotify.client"},
+		SystemSettings: []string{"Enable Home and End keys"},
+	}
+
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+	state, _ := os.ReadFile(home.StateFile())
+
+	_, output, err := runInstaller(t, params)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Install Karabiner rule files\nunchanged")
+	assert.Contains(t, output, "Update Karabiner config\nunchanged")
+	assert.Contains(t, output, "Install IDE keymaps\nunchanged")
+	assert.Contains(t, output, "Install Rectangle preferences\nunchanged")
+	assert.Contains(t, output, "Install AltTab preferences\nunchanged")
+	assert.NotContains(t, output, "killall")
+	assert.Contains(t, output, "Apply system settings\nunchanged")
+	assert.Contains(t, output, "Copy hidutil remapping file\nunchanged")
+	assert.Contains(t, output, "Save installation state\nunchanged")
+	reinstalledState, _ := os.ReadFile(home.StateFile())
+	assert.Equal(t, string(state), string(reinstalledState))
+}
+
+func TestReinstallWithAlfredChangesNothing(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "alfred",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	_, output, err := runInstaller(t, params)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Install app launcher preferences\nCopy file alfred/prefs.plist")
+
+	_, output, err = runInstaller(t, params)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Install app launcher preferences\nunchanged")
+	assert.NotContains(t, output, "plutil -replace")
+}
+
+func TestReinstallWithRaycastChangesNothing(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "raycast",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	_, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	t.Setenv("PCFY_DEFAULTS", "com.raycast.macos raycastGlobalHotkey Option-49")
+	_, output, err := runInstaller(t, params)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Install app launcher preferences\nunchanged")
+	assert.NotContains(t, output, "killall Raycast")
+	assert.NotContains(t, output, "open -a Raycast")
+}
+
+func TestJsonLog(t *testing.T) {
+
+	commander := install.NewDefaultCommander(false)
+	commander.Format = install.JsonLogFormat
+	logFile := testHomeDir().LogFile("install", test_utils.FakeTimeProvider{}.Now())
+	assert.NoError(t, commander.OpenLog(logFile))
+
+	_, output, err := runInstallerWithCommander(t, commander, param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}, cmd.TaskGroups{Only: []string{"rectangle"}})
+
+	assert.NoError(t, err)
+
+	var events []install.LogEvent
+
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var event install.LogEvent
+
+		assert.NoError(t, json.Unmarshal([]byte(line), &event), line)
+		events = append(events, event)
+	}
+
+	assert.Equal(t, "TASK", events[0].Type)
+	assert.Equal(t, "Validate Karabiner rules", events[0].Task)
+
+	var command *install.LogEvent
+
+	for _, e := range events {
+		if e.Type == "CMD" && e.Text == "open -a Rectangle" {
+			command = &e
+		}
+	}
+
+	assert.NotNil(t, command)
+	assert.Equal(t, "Open Rectangle.app", command.Task)
+	assert.Greater(t, command.Duration, 0.0)
+	assert.False(t, command.Timestamp.IsZero())
+
+	logged, _ := os.ReadFile(logFile)
+	assert.Equal(t, len(events), strings.Count(string(logged), "\n"))
+	assert.Contains(t, string(logged), `"type":"STATUS","text":"changed"`)
+	assert.Contains(t, string(logged), `"type":"REPORT","text":"PC'fied"`)
+}
+
+func TestInstallOnlySelectedGroups(t *testing.T) {
+
+	home, output, err := runInstallerWithGroups(t, param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}, cmd.TaskGroups{Only: []string{"rectangle", "hidutil"}, Skip: []string{"hidutil"}})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Install Rectangle preferences\nCopy file rectangle/com.knollsoft.Rectangle.plist")
+	assert.Contains(t, output, "Open Rectangle.app\nopen -a Rectangle\nchanged")
+	assert.Contains(t, output, "Update Karabiner config\nskipped")
+	assert.Contains(t, output, "Copy hidutil remapping file\nskipped")
+	assert.NoFileExists(t, home.KarabinerConfigFile())
+	assert.FileExists(t, filepath.Join(home.PreferencesDir(), "com.knollsoft.Rectangle.plist"))
+	assert.FileExists(t, home.StateFile())
+}
+
+func TestInstallWithUnknownGroup(t *testing.T) {
+
+	_, _, err := runInstallerWithGroups(t, param.Params{}, cmd.TaskGroups{Skip: []string{"finder"}})
+
+	assert.EqualError(t, err, "Unknown task group: finder")
+}
+
+func TestInstallSelectedGroupsWithRequiredTasksOfOtherGroups(t *testing.T) {
+
+	_, output, err := runInstallerWithGroups(t, param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}, cmd.TaskGroups{Only: []string{"rectangle"}})
+
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "Install dependencies\nskipped")
+	assert.Contains(t, output, "Update Karabiner config\nskipped")
+}
+
+func TestInstallWithRequiredTaskOfSkippedGroup(t *testing.T) {
+
+	_, _, err := runInstallerWithGroups(t, param.Params{}, cmd.TaskGroups{Only: []string{"karabiner"}, Skip: []string{"dependencies"}})
+
+	assert.EqualError(t, err, "Task \"Update Karabiner config\" requires \"Install dependencies\" from skipped group dependencies")
+}
+
+func TestDryRunDoesNotAskForDependencies(t *testing.T) {
+
+	t.Setenv("PCFY_MISSING_APPS", "Rectangle.app")
+	confirm := task.ConfirmDependencies
+	task.ConfirmDependencies = func(dependencies []string) bool {
+		t.Fatal("dependencies asked for in a dry run")
+		return false
+	}
+	defer func() { task.ConfirmDependencies = confirm }()
+
+	common.ExecCommand = fakeExecCommand
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	os.Setenv("HOME", testHomeDir().Path)
+	defer func() { common.ExecCommand = exec.Command }()
+	home := testHomeDir()
+	t.Cleanup(func() { tearDown(home) })
+
+	output, err := captureOutput(func() error {
+		return cmd.DryRun(home, test_utils.FakeTimeProvider{}, param.Params{
+			AppLauncher:    "spotlight",
+			Terminal:       "none",
+			KeyboardLayout: "pc",
+			Keymaps:        []string{},
+			Blacklist:      []string{},
+			SystemSettings: []string{},
+		}, io.Discard, install.TextLogFormat, cmd.Install)
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "brew install --cask rectangle")
+}
+
+func TestDryRunDoesNotAskForRuleConflicts(t *testing.T) {
+
+	task.AskConflictResolution = func(conflict string) string {
+		t.Fatal("rule conflict asked for in a dry run")
+		return param.KeepUser
+	}
+	defer func() { task.AskConflictResolution = askConflictResolution }()
+
+	common.ExecCommand = fakeExecCommand
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	os.Setenv("HOME", testHomeDir().Path)
+	defer func() { common.ExecCommand = exec.Command }()
+	home := testHomeDir()
+	t.Cleanup(func() { tearDown(home) })
+
+	output, err := captureOutput(func() error {
+		return cmd.DryRun(home, test_utils.FakeTimeProvider{}, param.Params{
+			AppLauncher:    "none",
+			Terminal:       "none",
+			KeyboardLayout: "pc",
+			Keymaps:        []string{},
+			Blacklist:      []string{},
+			SystemSettings: []string{},
+			CustomRules: []param.CustomRule{{
+				From: param.Key{KeyCode: "q", Modifiers: []string{"left_control"}},
+				To:   param.Key{KeyCode: "q", Modifiers: []string{"left_command"}},
+			}},
+			RuleConflicts: "ask",
+		}, io.Discard, install.TextLogFormat, cmd.Install)
+	})
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Resolving with install-both")
+}
+
+func TestDryRunDoesNotChangeAnything(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "default",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{"com.spotify.client"},
+		SystemSettings: []string{"Show hidden files in Finder"},
+	}
+
+	common.ExecCommand = fakeExecCommand
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	os.Setenv("HOME", testHomeDir().Path)
+	defer func() { common.ExecCommand = exec.Command }()
+	home := testHomeDir()
+	t.Cleanup(func() { tearDown(home) })
+
+	var log bytes.Buffer
+
+	output, err := captureOutput(func() error {
+		return cmd.DryRun(home, test_utils.FakeTimeProvider{}, params, &log, install.TextLogFormat, cmd.Install)
+	})
+
+	assert.NoError(t, err)
+	assert.NoFileExists(t, home.KarabinerConfigFile())
+	assert.NoFileExists(t, filepath.Join(home.PreferencesDir(), "com.lwouis.alt-tab-macos.plist"))
+	assert.Contains(t, output, "Copy file karabiner/app-launcher.json to ~/.config/karabiner/assets/complex_modifications/spotlight.json")
+	assert.Contains(t, output, `Update file ~/.config/karabiner/karabiner.json: add 2 rules from spotlight.json in profile "PCfy"`)
+	assert.Contains(t, output, "defaults write com.apple.finder AppleShowAllFiles -bool true")
+	assert.NotContains(t, output, "testing: warning: no tests to run")
+	assert.Contains(t, log.String(), `"task":"Apply system settings","type":"CMD","text":"defaults write com.apple.finder AppleShowAllFiles -bool true","dry_run":true}`)
+}
+
+func TestInstallSavesState(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{"GoLand"},
+		Blacklist:      []string{},
+		SystemSettings: []string{"Enable Dock auto-hide (2s delay)"},
+	}
+
+	home, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	state, err := install.LoadState(install.DefaultFileSystem{}, home.StateFile())
+	assert.NoError(t, err)
+
+	karabinerConfig, _ := os.ReadFile(home.KarabinerConfigFile())
+	checksum := sha256.Sum256(karabinerConfig)
+
+	assert.Equal(t, params, state.Params)
+	assert.Equal(t, test_utils.FakeTimeProvider{}.Now(), state.InstalledAt)
+	assert.Contains(t, state.Files, install.FileState{Path: home.KarabinerConfigFile(), Checksum: hex.EncodeToString(checksum[:])})
+	assert.Contains(t, state.Files, install.FileState{Path: home.IdeKeymapPaths(param.GoLand())[0], Checksum: fileChecksum(t, "../assets/keymaps/idea.xml")})
+	assert.Equal(t, []install.DefaultsState{
+		{Domain: "com.apple.dock", Key: "autohide", Value: "true"},
+		{Domain: "com.apple.dock", Key: "autohide-delay", Value: "2"},
+	}, state.Defaults)
+	assert.Equal(t, filepath.Join(home.LaunchAgents(), "com.github.pcfy-my-mac.plist"), state.LaunchAgent)
+}
+
+func fileChecksum(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	checksum := sha256.Sum256(data)
+	return hex.EncodeToString(checksum[:])
+}
+
+func TestUninstallRevertsInstallation(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "default",
+		KeyboardLayout: "pc",
+		Keymaps:        param.IdeKeymapOptions(),
+		Blacklist:      []string{},
+		SystemSettings: []string{"Enable Home and End keys", "Show hidden files in Finder"},
+		FunctionKeys:   "standard",
+	}
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+
+	home, _, _ := runInstaller(t, params)
+	output, err := runUninstaller(t)
+
+	assert.NoError(t, err)
+	test_utils.AssertFilesEqual(t, home.KarabinerConfigFile(), "assets/custom.json")
+	assert.NoFileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), "main.json"))
+	assert.NoFileExists(t, filepath.Join(home.KarabinerComplexModificationsDir(), "spotlight.json"))
+	assert.NoFileExists(t, filepath.Join(home.LaunchAgents(), "com.github.pcfy-my-mac.plist"))
+	assert.NoFileExists(t, filepath.Join(home.LibraryDir(), "KeyBindings/DefaultKeyBinding.dict"))
+	assert.Empty(t, existingFiles(home.IdesKeymapPaths(param.IDEKeymaps)))
+	assert.Contains(t, output, "defaults delete com.apple.finder AppleShowAllFiles 2>/dev/null || true")
+	assert.Contains(t, output, "defaults delete -g com.apple.keyboard.fnState 2>/dev/null || true")
+	assert.Contains(t, output, `hidutil property --set '{"UserKeyMapping":[]}'`)
+	assert.NoFileExists(t, home.StateFile())
+}
+
+func TestUninstallRestoresKarabinerConfigBackup(t *testing.T) {
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+
+	home, _, err := runInstaller(t, param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+	assert.NoError(t, err)
+
+	installed := test_utils.ReadFile(home.KarabinerConfigFile())
+	os.WriteFile(home.KarabinerConfigFile(), []byte(strings.Replace(installed, `"show_in_menu_bar": true`, `"show_in_menu_bar": false`, 1)), 0644)
+
+	output, err := runUninstaller(t)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "restore ~/.config/karabiner/karabiner-27-09-2023_12:30:00.json")
+	test_utils.AssertFilesEqual(t, home.KarabinerConfigFile(), "assets/custom.json")
+}
+
+func TestUninstallWithoutBackupRemovesProfile(t *testing.T) {
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+
+	home, _, err := runInstaller(t, param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+	assert.NoError(t, err)
+
+	os.Remove(home.KarabinerConfigBackupFile(test_utils.FakeTimeProvider{}.Now()))
+	output, err := runUninstaller(t)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, `delete profile "PCfy"`)
+	assert.Contains(t, output, "No Karabiner config backup found. Selecting the first profile...")
+
+	config, _ := karabiner.LoadConfig(home.KarabinerConfigFile())
+	assert.Len(t, config.Profiles, 1)
+	assert.Equal(t, "Custom", config.Profiles[0].Name)
+}
+
+func TestUninstallWithoutStateKeepsDefaults(t *testing.T) {
+
+	output, err := runUninstaller(t)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "No installation state found. Leaving the defaults keys as they are...")
+	assert.NotContains(t, output, "defaults delete")
+	assert.NotContains(t, output, "defaults write")
+}
+
+func TestInstallProfilesSideBySide(t *testing.T) {
+
+	params := param.Params{
+		AppLauncher:    "none",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	}
+
+	homeDir := testHomeDir()
+	os.MkdirAll(homeDir.KarabinerConfigDir(), 0755)
+	common.CopyFile("assets/custom.json", homeDir.KarabinerConfigFile())
+
+	params.Profile = "PCfy-work"
+	_, _, err := runInstaller(t, params)
+	assert.NoError(t, err)
+
+	params.Profile = "PCfy-gaming"
+	params.SelectProfile = new(bool)
+	_, _, err = runInstaller(t, params)
+	assert.NoError(t, err)
+
+	selected := func() map[string]bool {
+		config, _ := karabiner.LoadConfig(homeDir.KarabinerConfigFile())
+		profiles := map[string]bool{}
+
+		for _, p := range config.Profiles {
+			profiles[p.Name] = p.Selected != nil && *p.Selected
+		}
+
+		return profiles
+	}
+
+	assert.Equal(t, map[string]bool{"Custom": false, "PCfy-work": true, "PCfy-gaming": false}, selected())
+
+	state, _ := install.LoadState(install.DefaultFileSystem{}, homeDir.StateFile())
+	assert.Equal(t, []string{"PCfy-gaming", "PCfy-work"}, state.Profiles)
+
+	_, err = runUninstaller(t)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Custom": true}, selected())
+}
+
+func TestDoctorAfterInstall(t *testing.T) {
+
+	home, _, err := runInstaller(t, param.Params{
+		AppLauncher:    "spotlight",
+		Terminal:       "none",
+		KeyboardLayout: "pc",
+		Keymaps:        []string{"GoLand"},
+		Blacklist:      []string{},
+		SystemSettings: []string{},
+	})
+	assert.NoError(t, err)
+
+	keymap := home.IdeKeymapPaths(param.GoLand())[0]
+	os.WriteFile(keymap, []byte("<keymap/>"), 0644)
+
+	output, err := runDoctor(t)
+
+	assert.NoError(t, err)
+	assert.Contains(t, output, "[PASS] Karabiner-Elements: installed")
+	assert.Contains(t, output, `[PASS] Karabiner profile: profile "PCfy" exists and is selected`)
+	assert.Contains(t, output, "[PASS] LaunchAgent: ~/Library/LaunchAgents/com.github.pcfy-my-mac.plist is up to date")
+	assert.Contains(t, output, "[PASS] hidutil mapping: modifier key mapping is active")
+	assert.Contains(t, output, "[WARN] GoLand keymap: "+strings.ReplaceAll(keymap, home.Path, "~")+" differs from the bundled version\n        Fix: Run: pcfy-my-mac install")
+}
+
+func TestDoctorWithoutInstallation(t *testing.T) {
+
+	output, err := runDoctor(t)
+
+	assert.EqualError(t, err, "2 check(s) failed")
+	assert.Contains(t, output, "[FAIL] Karabiner profile: ~/.config/karabiner/karabiner.json not found\n        Fix: Run: pcfy-my-mac install")
+	assert.Contains(t, output, "[FAIL] LaunchAgent: ~/Library/LaunchAgents/com.github.pcfy-my-mac.plist not found")
+	assert.Contains(t, output, "[WARN] IDE keymaps: no installed keymaps found")
+}
+
+func runDoctor(t *testing.T) (string, error) {
+	common.ExecCommand = fakeExecCommand
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	os.Setenv("HOME", testHomeDir().Path)
+	defer func() { common.ExecCommand = exec.Command }()
+	commander := install.NewDefaultCommander(true)
+	homeDir := testHomeDir()
+	t.Cleanup(func() { tearDown(homeDir) })
+	output, err := captureOutput(func() error {
+		return cmd.Doctor(homeDir, commander, test_utils.FakeTimeProvider{})
+	})
+	return regexp.MustCompile("\033\\[[0-9;]*m").ReplaceAllString(output, ""), err
+}
+
+func runUninstaller(t *testing.T) (string, error) {
+	common.ExecCommand = fakeExecCommand
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	os.Setenv("HOME", testHomeDir().Path)
+	defer func() { common.ExecCommand = exec.Command }()
+	commander := install.NewDefaultCommander(true)
+	homeDir := testHomeDir()
+	t.Cleanup(func() { tearDown(homeDir) })
+	return captureOutput(func() error {
+		return cmd.LaunchUninstall(homeDir, commander, test_utils.FakeTimeProvider{})
+	})
+}
+
+func existingFiles(paths []string) []string {
+	var existing []string
+
+	for _, p := range paths {
+		if common.FileExists(p) {
+			existing = append(existing, p)
+		}
+	}
+
+	return existing
+}
+
+func runInstaller(t *testing.T, params param.Params) (install.HomeDir, string, error) {
+	return runInstallerWithGroups(t, params, cmd.TaskGroups{})
+}
+
+func runInstallerWithGroups(t *testing.T, params param.Params, groups cmd.TaskGroups) (install.HomeDir, string, error) {
+	return runInstallerWithCommander(t, install.NewDefaultCommander(true), params, groups)
+}
+
+func runInstallerWithCommander(t *testing.T, commander install.Commander, params param.Params, groups cmd.TaskGroups) (install.HomeDir, string, error) {
+	common.ExecCommand = fakeExecCommand
+	os.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	os.Setenv("HOME", testHomeDir().Path)
+	defer func() { common.ExecCommand = exec.Command }()
+	homeDir := testHomeDir()
+	var err error = nil
+	output, err := captureOutput(func() error {
+		err := cmd.Launch(homeDir, commander, test_utils.FakeTimeProvider{}, params, groups)
+		return err
+	})
+	t.Cleanup(func() { tearDown(homeDir) })
+	return homeDir, output, err
 }
 
 func testHomeDir() install.HomeDir {
@@ -332,9 +1682,63 @@ func fakeExecCommand(command string, args ...string) *exec.Cmd {
 	cs := []string{"-test.run=TestHelperProcess", "--", command}
 	cs = append(cs, args...)
 	execCommand := exec.Command(os.Args[0], cs...)
+	execCommand.Env = append(os.Environ(), "PCFY_HELPER_PROCESS=1")
 	return execCommand
 }
 
+// TestHelperProcess stands in for the commands run by the installer
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("PCFY_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	args = args[1:]
+
+	switch {
+	case args[0] == "/bin/bash" && args[2] == os.Getenv("PCFY_FAILING_COMMAND"):
+		fmt.Fprintln(os.Stderr, "Unable to find application named 'Rectangle'")
+		os.Exit(3)
+	case args[0] == "pgrep":
+		os.Exit(1)
+	case args[0] == "mdfind" && slices.Contains(strings.Split(os.Getenv("PCFY_MISSING_APPS"), ","), args[len(args)-1]):
+		break
+	case args[0] == "mdfind":
+		fmt.Println("/Applications/" + args[len(args)-1])
+	case args[0] == "defaults" && args[1] == "read":
+		if value, found := strings.CutPrefix(os.Getenv("PCFY_DEFAULTS"), args[2]+" "+args[3]+" "); found {
+			fmt.Println(value)
+			break
+		}
+
+		os.Exit(1)
+	case args[0] == "hidutil" && args[1] == "property" && args[2] == "--get":
+		fmt.Println(`(
+    {
+        HIDKeyboardModifierMappingDst = 30064771299;
+        HIDKeyboardModifierMappingSrc = 30064771296;
+    },
+    {
+        HIDKeyboardModifierMappingDst = 30064771296;
+        HIDKeyboardModifierMappingSrc = 30064771299;
+    },
+    {
+        HIDKeyboardModifierMappingDst = 30064771303;
+        HIDKeyboardModifierMappingSrc = 30064771300;
+    },
+    {
+        HIDKeyboardModifierMappingDst = 30064771300;
+        HIDKeyboardModifierMappingSrc = 30064771303;
+    }
+)`)
+	}
+
+	os.Exit(0)
+}
+
 func captureOutput(f func() error) (string, error) {
 	orig := os.Stdout
 	r, w, _ := os.Pipe()
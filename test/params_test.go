@@ -2,8 +2,10 @@ package install_test
 
 import (
 	"github.com/raxigan/pcfy-my-mac/cmd/common"
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
 	"github.com/raxigan/pcfy-my-mac/cmd/param"
 	"github.com/raxigan/pcfy-my-mac/test/test_utils"
+	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
@@ -39,6 +41,7 @@ func TestInstallInvalidAppLauncher(t *testing.T) {
 		spotlight
 		launchpad
 		alfred
+		raycast
 		none`)
 }
 
@@ -52,9 +55,37 @@ func TestInstallInvalidTerminal(t *testing.T) {
 		iterm
 		warp
 		wave
+		alacritty
+		kitty
+		wezterm
+		ghostty
+		hyper
 		none`)
 }
 
+func TestReadCustomTerminal(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		terminal:
+		  app: Acme Term.app
+		  bundle-id: com.acme.term
+		  args: [--login]`)
+	fp, err := param.CollectYamlParams(yml)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &param.CustomTerminal{App: "Acme Term.app", BundleID: "com.acme.term", Args: []string{"--login"}}, fp.Terminal.Custom)
+}
+
+func TestInstallCustomTerminalWithoutBundleId(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		terminal:
+		  app: Acme Term.app`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'terminal': app and bundle-id are required")
+}
+
 func TestInstallInvalidKeyboardLayout(t *testing.T) {
 
 	yml := test_utils.Trim(`keyboard-layout: unknown`)
@@ -65,9 +96,125 @@ func TestInstallInvalidKeyboardLayout(t *testing.T) {
 		mac`)
 }
 
+func TestInstallInvalidCustomRuleKeyCode(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		custom-rules:
+		  - from: { key: k, modifiers: [left_control] }
+		    to: { key: kay }`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'custom-rules' rule 1: unknown key code 'kay'")
+}
+
+func TestInstallInvalidCustomRuleModifier(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		custom-rules:
+		  - from: { key: k, modifiers: [ctrl] }
+		    to: { key: k, modifiers: [left_command] }`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'custom-rules' rule 1: unknown modifier 'ctrl', valid modifiers:")
+}
+
+func TestCustomRuleWithModifierAliases(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		custom-rules:
+		  - from: { key: k, modifiers: [left_alt, right_gui] }
+		    to: { key: k, modifiers: [left_gui] }`)
+	_, err := param.CollectYamlParams(yml)
+
+	assert.NoError(t, err)
+}
+
+func TestInstallInvalidKarabinerRule(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		karabiner-rules:
+		  exclude: [alt-f4, unknown]`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'karabiner-rules' value/s 'unknown', valid values:\nctrl-left-arrow")
+}
+
+func TestInstallInvalidExcludedApp(t *testing.T) {
+
+	yml := test_utils.Trim(`excluded-apps: ["^com\\.microsoft\\.VSCode$", "^com.(emacs"]`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'excluded-apps' bundle ID pattern '^com.(emacs': error parsing regexp: missing closing )")
+}
+
+func TestInstallInvalidRuleConflicts(t *testing.T) {
+
+	yml := test_utils.Trim(`rule-conflicts: ignore`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, `Invalid param 'rule-conflicts' value/s 'ignore', valid values:
+		install-both
+		keep-user
+		keep-pcfy
+		ask`)
+}
+
+func TestInstallKarabinerParameterOutOfRange(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		karabiner-parameters:
+		  to-if-alone-timeout: 20`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'karabiner-parameters' to-if-alone-timeout '20', valid range: 100-5000")
+}
+
+func TestInstallUnknownKarabinerParameter(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		karabiner-parameters:
+		  to-if-alone-timout: 300`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Unknown parameter: karabiner-parameters.to-if-alone-timout")
+}
+
+func TestInstallInvalidCustomFunctionKey(t *testing.T) {
+
+	yml := test_utils.Trim(`
+		function-keys: custom
+		custom-function-keys: { f5: reload }`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, "Invalid param 'custom-function-keys' f5: unknown key code 'reload'")
+}
+
+func TestKarabinerRuleCatalogCoversBundledRules(t *testing.T) {
+
+	var catalog []string
+
+	for _, r := range param.KarabinerRules {
+		catalog = append(catalog, r.File+": "+r.Description)
+	}
+
+	var bundled []string
+
+	for _, file := range []string{"main.json", "finder.json"} {
+		data, _ := common.ReadFileFromEmbedFS("karabiner/" + file)
+		ruleSet, err := karabiner.ParseRuleSet([]byte(data))
+		assert.NoError(t, err)
+
+		for _, r := range ruleSet.Rules {
+			bundled = append(bundled, file+": "+r.Description)
+		}
+	}
+
+	assert.Equal(t, bundled, catalog)
+}
+
 func TestReadParamsFromYmlFile(t *testing.T) {
 
-	params, _ := param.CollectParams("assets/params.yml")
+	params, _ := param.CollectParams("assets/params.yml", nil)
 
 	test_utils.AssertEquals(t, params.AppLauncher, "alfred")
 	test_utils.AssertEquals(t, params.Terminal, "warp")
@@ -84,9 +231,128 @@ func TestReadParamsFromYmlFile(t *testing.T) {
 	)
 }
 
+func TestReadParamsFileWithoutKarabinerRules(t *testing.T) {
+
+	params, err := param.CollectParams("assets/params.yml", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, params.ExcludedRules)
+
+	fp, err := param.CollectYamlParams(test_utils.Trim(`
+		preset: xfce
+		keyboard-layout: none
+		keymaps: []`))
+	assert.NoError(t, err)
+
+	params = param.CollectSurveyParams(fp, nil)
+
+	assert.Equal(t, []string{"win-l-lock-screen"}, params.ExcludedRules)
+}
+
+func TestReadParamsFileWithoutKeyboards(t *testing.T) {
+
+	config, err := karabiner.LoadConfig("assets/custom.json")
+	assert.NoError(t, err)
+
+	params, err := param.CollectParams("assets/params.yml", config)
+
+	assert.NoError(t, err)
+	assert.Empty(t, params.Keyboards)
+}
+
+func TestReadParamsFileWithoutRuleConflicts(t *testing.T) {
+
+	params, err := param.CollectParams("assets/params.yml", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Install both", params.RuleConflicts)
+}
+
+func TestReadParamsFileWithoutFunctionKeys(t *testing.T) {
+
+	params, err := param.CollectParams("assets/params.yml", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Standard", params.FunctionKeys)
+}
+
+func TestReadParamsFileWithoutPreset(t *testing.T) {
+
+	params, err := param.CollectParams("assets/params.yml", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "None", params.Preset)
+}
+
+func TestReadParamsWithPreset(t *testing.T) {
+
+	fp, err := param.CollectYamlParams(test_utils.Trim(`
+		preset: kde
+		app-launcher: spotlight
+		keyboard-layout: none
+		keymaps: []`))
+	assert.NoError(t, err)
+
+	params := param.CollectSurveyParams(fp, nil)
+
+	test_utils.AssertEquals(t, params.AppLauncher, "spotlight")
+	test_utils.AssertEquals(t, params.Terminal, "Default")
+	test_utils.AssertEquals(t, params.FunctionKeys, "Standard")
+	assert.Contains(t, params.SystemSettings, "Show directories on top in Finder")
+	assert.Empty(t, params.CustomRules)
+
+	preset, found := params.SelectedPreset()
+	assert.True(t, found)
+	assert.Equal(t, "Meta + E (Open Finder)", preset.Rules(params.AppLauncher)[0].Description)
+}
+
+func TestReadParamsWithPresetRunDialog(t *testing.T) {
+
+	for launcher, to := range map[string]param.Key{
+		"launchpad": {KeyCode: "launchpad"},
+		"alfred":    {KeyCode: "spacebar", Modifiers: []string{"option"}},
+		"none":      {KeyCode: "spacebar", Modifiers: []string{"left_command"}},
+	} {
+		fp, err := param.CollectYamlParams(test_utils.Trim(`
+			preset: xfce
+			app-launcher: ` + launcher + `
+			keyboard-layout: none
+			keymaps: []`))
+		assert.NoError(t, err)
+
+		params := param.CollectSurveyParams(fp, nil)
+		preset, _ := params.SelectedPreset()
+
+		assert.Equal(t, []param.CustomRule{
+			{
+				Description: "Ctrl + Alt + L (Lock Screen)",
+				From:        param.Key{KeyCode: "l", Modifiers: []string{"left_control", "option"}},
+				To:          param.Key{KeyCode: "q", Modifiers: []string{"left_command", "left_control"}},
+			},
+			{
+				Description: "Alt + F2 (Run dialog)",
+				From:        param.Key{KeyCode: "f2", Modifiers: []string{"option"}},
+				To:          to,
+			},
+		}, preset.Rules(params.AppLauncher))
+	}
+}
+
+func TestInstallInvalidPreset(t *testing.T) {
+
+	yml := test_utils.Trim(`preset: unknown`)
+	_, err := param.CollectYamlParams(yml)
+
+	test_utils.AssertErrorContains(t, err, `Invalid param 'preset' value/s 'unknown', valid values:
+		gnome
+		kde
+		windows
+		xfce
+		none`)
+}
+
 func TestReadParamsFromNonexistentFile(t *testing.T) {
 
-	_, err := param.CollectParams("i-do-not-exist.yml")
+	_, err := param.CollectParams("i-do-not-exist.yml", nil)
 
 	test_utils.AssertErrorContains(t, err, "open i-do-not-exist.yml: no such file or directory")
 }
@@ -0,0 +1,90 @@
+package install_test
+
+import (
+	"github.com/raxigan/pcfy-my-mac/cmd/karabiner"
+	"github.com/raxigan/pcfy-my-mac/cmd/param"
+	"github.com/raxigan/pcfy-my-mac/cmd/task"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+)
+
+func TestBundledKarabinerFilesAreValid(t *testing.T) {
+
+	problems, err := task.LintBundledKarabinerFiles()
+
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestLintReportsJsonPaths(t *testing.T) {
+
+	problems := task.LintKarabinerFile("rules.json", []byte(`{
+		"title": "Rules",
+		"rules": [
+			{
+				"description": "Typos",
+				"manipulators": [
+					{
+						"type": "basic",
+						"from": {"key_code": "f44", "modifiers": {"mandatory": ["ctrl"], "optional": ["any"]}},
+						"to": [{"consumer_key_code": "mute"}, {"key_code": "a", "modifiers": "left_comand"}],
+						"conditions": [{"type": "frontmost_app_if", "bundle_identifiers": ["^com\\.(foo"]}]
+					}
+				]
+			}
+		]
+	}`))
+
+	assert.Equal(t, []string{
+		`rules.json: $.rules[0].manipulators[0].from.key_code: unknown key code "f44"`,
+		`rules.json: $.rules[0].manipulators[0].from.modifiers.mandatory[0]: unknown modifier "ctrl"`,
+		`rules.json: $.rules[0].manipulators[0].to[1].modifiers[0]: unknown modifier "left_comand"`,
+		`rules.json: $.rules[0].manipulators[0].conditions[0].type: unknown condition type "frontmost_app_if"`,
+		"rules.json: $.rules[0].manipulators[0].conditions[0].bundle_identifiers[0]: invalid regex \"^com\\\\.(foo\": error parsing regexp: missing closing ): `^com\\.(foo`",
+	}, problems)
+}
+
+func TestLintAcceptsModifierAliases(t *testing.T) {
+
+	problems := task.LintKarabinerFile("rules.json", []byte(`{
+		"title": "Rules",
+		"rules": [
+			{
+				"description": "Aliases",
+				"manipulators": [
+					{
+						"type": "basic",
+						"from": {"key_code": "left_gui", "modifiers": {"mandatory": ["left_alt"], "optional": ["right_alt"]}},
+						"to": [{"key_code": "a", "modifiers": ["right_gui"]}]
+					}
+				]
+			}
+		]
+	}`))
+
+	assert.Empty(t, problems)
+}
+
+func TestLintReportsInvalidJson(t *testing.T) {
+
+	problems := task.LintKarabinerFile("rules.json", []byte(`{"rules": [`))
+
+	assert.Equal(t, []string{"rules.json: unexpected end of JSON input"}, problems)
+}
+
+func TestLintBundledKarabinerFilesRendersTemplates(t *testing.T) {
+
+	launchers := param.AppLaunchers
+	param.AppLaunchers = append(slices.Clone(launchers), param.AppLauncher{Name: "Typo", Title: "Typo", Key: []karabiner.Event{{KeyCode: "f44"}}})
+	defer func() { param.AppLaunchers = launchers }()
+
+	problems, err := task.LintBundledKarabinerFiles()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`typo.json: $.rules[0].manipulators[0].to_if_alone[0].key_code: unknown key code "f44"`,
+		`typo.json: $.rules[0].manipulators[2].to_if_alone[0].key_code: unknown key code "f44"`,
+		`typo.json: $.rules[1].manipulators[0].to_if_alone[0].key_code: unknown key code "f44"`,
+	}, problems)
+}